@@ -0,0 +1,66 @@
+package wserver
+
+import (
+	"net"
+	"net/http"
+)
+
+type accessRule struct {
+	path  string
+	allow ipNets
+	deny  ipNets
+}
+
+/**
+  Aspect rejecting clients by ip , every rule matching the path has to pass
+*/
+type accessAspect struct {
+	rules []accessRule
+}
+
+func newAccessAspect(rules []AccessRule) (*accessAspect, error) {
+	aspect := &accessAspect{}
+	for _, rule := range rules {
+		allow, err := parseIPNets(rule.Allow)
+		if err != nil {
+			return nil, err
+		}
+		deny, err := parseIPNets(rule.Deny)
+		if err != nil {
+			return nil, err
+		}
+		aspect.rules = append(aspect.rules, accessRule{path: trimPathWildcard(rule.Path), allow: allow, deny: deny})
+	}
+	return aspect, nil
+}
+
+func (a *accessAspect) ShouldAppendOn(req *http.Request) bool {
+	return true
+}
+
+func (a *accessAspect) BeforeOrAfter() bool {
+	return true
+}
+
+func (a *accessAspect) Server(context ServletContext, resp http.ResponseWriter, req *http.Request) bool {
+	if !a.allowed(req.URL.Path, net.ParseIP(context.GetClientIP())) {
+		http.Error(resp, STATUS_FORBIDDEN.statusMessage, STATUS_FORBIDDEN.statusCode)
+		return false
+	}
+	return true
+}
+
+func (a *accessAspect) allowed(path string, ip net.IP) bool {
+	for _, rule := range a.rules {
+		if !pathUnder(path, rule.path) {
+			continue
+		}
+		if rule.deny.contains(ip) {
+			return false
+		}
+		if len(rule.allow) != 0 && !rule.allow.contains(ip) {
+			return false
+		}
+	}
+	return true
+}
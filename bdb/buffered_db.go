@@ -1,6 +1,7 @@
 package bdb
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"log"
@@ -33,6 +34,18 @@ type BufferedDB interface {
 	BeginTransactional() (BufferedTransactional, error)
 }
 
+//optional methods of a BufferedDB , the db returned by NewBufferedDb implements them ,
+//callers check for them with a type assertion
+type ContextDB interface {
+	BufferedDB
+
+	//return a copy of the db whose statements are bound to ctx and stop when it is done
+	WithContext(ctx context.Context) ContextDB
+
+	//check the db is reachable
+	Ping() error
+}
+
 type txManager interface {
 	Prepare(query string) (*sql.Stmt, error)
 }
@@ -55,6 +68,7 @@ var timeType = reflect.TypeOf(time.Time{})
 type defaultBdb struct {
 	txManager
 	preparedStmtMap map[string]*sql.Stmt
+	ctx             context.Context
 }
 
 type defaultBtx struct {
@@ -63,7 +77,29 @@ type defaultBtx struct {
 }
 
 func NewBufferedDb(db *sql.DB) BufferedDB {
-	return &defaultBdb{db, map[string]*sql.Stmt{}}
+	return &defaultBdb{db, map[string]*sql.Stmt{}, context.Background()}
+}
+
+func (tdb *defaultBdb) WithContext(ctx context.Context) ContextDB {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &defaultBdb{tdb.txManager, tdb.preparedStmtMap, ctx}
+}
+
+func (tdb *defaultBdb) Ping() error {
+	s, ok := tdb.txManager.(*sql.DB)
+	if !ok {
+		return nil
+	}
+	return s.PingContext(tdb.context())
+}
+
+func (tdb *defaultBdb) context() context.Context {
+	if tdb.ctx == nil {
+		return context.Background()
+	}
+	return tdb.ctx
 }
 
 func (tdb *defaultBdb) SelectInInterface(sqlSequence string, v interface{}, parameters ...interface{}) error {
@@ -71,7 +107,7 @@ func (tdb *defaultBdb) SelectInInterface(sqlSequence string, v interface{}, para
 	if err != nil {
 		return err
 	}
-	return selectInInterface(sqlStmt, v, parameters...)
+	return selectInInterface(tdb.context(), sqlStmt, v, parameters...)
 }
 
 func (tdb *defaultBdb) getPreparedStatement(sqlSentence string) (*sql.Stmt, error) {
@@ -95,7 +131,7 @@ func (tdb *defaultBdb) ExecutePreparedSql(sqlState string, parameters ...interfa
 	if err != nil {
 		return nil, err
 	}
-	return sqlStmt.Exec(parameters...)
+	return sqlStmt.ExecContext(tdb.context(), parameters...)
 }
 
 func (tdb *defaultBdb) ExecuteDbSequence(sequence string, parameter interface{}) (sql.Result, error) {
@@ -113,8 +149,8 @@ func (tdb *defaultBdb) BeginTransactional() (BufferedTransactional, error) {
 	if !ok {
 		return nil, nil
 	}
-	t, e := s.Begin()
-	return &defaultBtx{defaultBdb{t,map[string]*sql.Stmt{}}, t}, e
+	t, e := s.BeginTx(tdb.context(), nil)
+	return &defaultBtx{defaultBdb{t, map[string]*sql.Stmt{}, tdb.context()}, t}, e
 }
 
 func (btx *defaultBtx) getPreparedStatement(sqlSentence string) (*sql.Stmt, error) {
@@ -169,18 +205,19 @@ func getParameterValues(object interface{}, names string) interface{} {
 	}
 }
 
-func selectInInterface(sqlStmt *sql.Stmt, v interface{}, parameters ...interface{}) (err error) {
+func selectInInterface(ctx context.Context, sqlStmt *sql.Stmt, v interface{}, parameters ...interface{}) (err error) {
 	var rows *sql.Rows
 
 	if parameters == nil || len(parameters) == 0 {
-		rows, err = sqlStmt.Query()
+		rows, err = sqlStmt.QueryContext(ctx)
 	} else {
-		rows, err = sqlStmt.Query(parameters...)
+		rows, err = sqlStmt.QueryContext(ctx, parameters...)
 	}
 
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
 
 	rowColumns, err := rows.Columns()
 	if err != nil {
@@ -349,7 +386,7 @@ func selectInInterface(sqlStmt *sql.Stmt, v interface{}, parameters ...interface
 	default:
 		return errors.New("unknown type:" + typeOfBean.Kind().String())
 	}
-	return nil
+	return rows.Err()
 }
 
 func getMatchedColumns(actualType reflect.Type, rowColumns []string) (columnCache []int, err error) {
@@ -0,0 +1,148 @@
+package wserver
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	. "github.com/fitmewell/wserver/log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+/**
+  Handler result carrying its own validators , a []byte or string Body is written as it is (a string is
+  not rendered as a template) , other values are written as json
+*/
+type Conditional struct {
+	ETag         string
+	LastModified time.Time
+	Body         interface{}
+}
+
+//check If-Match , If-Unmodified-Since and If-None-Match of an update against the current version of the resource ,
+//an empty etag means the resource does not exist , return STATUS_PRECONDITION_FAILED when the update should not go on
+func CheckPreconditions(req *http.Request, etag string, lastModified time.Time) error {
+	if etag != "" {
+		etag = quoteETag(etag)
+	}
+	if ifMatch := req.Header.Get("If-Match"); ifMatch != "" {
+		if !matchETag(ifMatch, etag, false) {
+			return STATUS_PRECONDITION_FAILED
+		}
+	} else if since, err := http.ParseTime(req.Header.Get("If-Unmodified-Since")); err == nil && !lastModified.IsZero() {
+		if lastModified.Truncate(time.Second).After(since) {
+			return STATUS_PRECONDITION_FAILED
+		}
+	}
+	if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch != "" && !isSafeMethod(req.Method) {
+		if matchETag(ifNoneMatch, etag, true) {
+			return STATUS_PRECONDITION_FAILED
+		}
+	}
+	return nil
+}
+
+func (h *wHandler) writeConditional(resp http.ResponseWriter, req *http.Request, c Conditional) {
+	var body []byte
+	switch b := c.Body.(type) {
+	case nil:
+	case []byte:
+		body = b
+	case string:
+		body = []byte(b)
+	default:
+		resp.Header().Set("Content-Type", "application/json")
+		tb, err := json.Marshal(b)
+		if err != nil {
+			Debug(err)
+			resp.Write([]byte(err.Error()))
+			return
+		}
+		body = tb
+	}
+	h.writeBody(resp, req, body, c.ETag, c.LastModified)
+}
+
+//write body with validators , answer 304 when the client copy is still fresh
+func (h *wHandler) writeBody(resp http.ResponseWriter, req *http.Request, body []byte, etag string, lastModified time.Time) {
+	if etag == "" && h.wServer.config.AutoETag && isReadMethod(req.Method) {
+		sum := sha1.Sum(body)
+		etag = hex.EncodeToString(sum[:])
+	}
+	if etag != "" {
+		etag = quoteETag(etag)
+		resp.Header().Set("ETag", etag)
+	}
+	if !lastModified.IsZero() {
+		resp.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if isReadMethod(req.Method) && notModified(req, etag, lastModified) {
+		header := resp.Header()
+		header.Del("Content-Type")
+		header.Del("Content-Length")
+		resp.WriteHeader(http.StatusNotModified)
+		return
+	}
+	resp.Write(body)
+}
+
+func notModified(req *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etag != "" && matchETag(ifNoneMatch, etag, true)
+	}
+	if lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+//match etag against a header list , weak comparison ignores the W/ prefix
+func matchETag(list string, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	} else if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		} else if strings.HasPrefix(candidate, "W/") {
+			continue
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func quoteETag(etag string) string {
+	if strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
+
+func isReadMethod(method string) bool {
+	return method == "GET" || method == "HEAD"
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package wserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMatchETag(t *testing.T) {
+	cases := []struct {
+		list  string
+		etag  string
+		weak  bool
+		match bool
+	}{
+		{`"a"`, `"a"`, false, true},
+		{`"b", "a"`, `"a"`, false, true},
+		{`W/"a"`, `"a"`, false, false},
+		{`W/"a"`, `"a"`, true, true},
+		{`*`, `"a"`, false, true},
+		{`*`, ``, false, false},
+		{`"b"`, `"a"`, true, false},
+	}
+	for _, c := range cases {
+		if got := matchETag(c.list, c.etag, c.weak); got != c.match {
+			t.Errorf("matchETag(%q, %q, %v) = %v", c.list, c.etag, c.weak, got)
+		}
+	}
+}
+
+func TestWriteBodyNotModified(t *testing.T) {
+	h := newDefaultHandler(NewServer(&ServerConfig{AutoETag: true}))
+	resp := httptest.NewRecorder()
+	h.writeBody(resp, httptest.NewRequest("GET", "/", nil), []byte("hello"), "", time.Time{})
+	etag := resp.Header().Get("ETag")
+	if resp.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected 200 with ETag, got %d %q", resp.Code, etag)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", etag)
+	resp = httptest.NewRecorder()
+	h.writeBody(resp, req, []byte("hello"), "", time.Time{})
+	if resp.Code != http.StatusNotModified || resp.Body.Len() != 0 {
+		t.Fatalf("expected empty 304, got %d %q", resp.Code, resp.Body.String())
+	}
+
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-Modified-Since", modified.Format(http.TimeFormat))
+	resp = httptest.NewRecorder()
+	h.writeBody(resp, req, []byte("hello"), "v1", modified)
+	if resp.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 from If-Modified-Since, got %d", resp.Code)
+	}
+}
+
+func TestWriteConditional(t *testing.T) {
+	h := newDefaultHandler(NewServer(&ServerConfig{}))
+	resp := httptest.NewRecorder()
+	h.writeConditional(resp, httptest.NewRequest("GET", "/", nil), Conditional{ETag: "v1", Body: "index.html"})
+	if resp.Body.String() != "index.html" || resp.Header().Get("ETag") != `"v1"` {
+		t.Errorf("string body should be written as it is, got %q %q", resp.Body.String(), resp.Header().Get("ETag"))
+	}
+	resp = httptest.NewRecorder()
+	h.writeConditional(resp, httptest.NewRequest("GET", "/", nil), Conditional{Body: map[string]int{"a": 1}})
+	if resp.Body.String() != `{"a":1}` || resp.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("other bodies should be json, got %q", resp.Body.String())
+	}
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	req := httptest.NewRequest("PUT", "/", nil)
+	req.Header.Set("If-Match", `"v1"`)
+	if err := CheckPreconditions(req, "v1", time.Time{}); err != nil {
+		t.Errorf("matching If-Match rejected: %v", err)
+	}
+	if err := CheckPreconditions(req, "v2", time.Time{}); err != STATUS_PRECONDITION_FAILED {
+		t.Errorf("stale If-Match accepted: %v", err)
+	}
+
+	req = httptest.NewRequest("PUT", "/", nil)
+	req.Header.Set("If-None-Match", "*")
+	if err := CheckPreconditions(req, "v1", time.Time{}); err != STATUS_PRECONDITION_FAILED {
+		t.Errorf("If-None-Match * on existing resource accepted: %v", err)
+	}
+	if err := CheckPreconditions(req, "", time.Time{}); err != nil {
+		t.Errorf("If-None-Match * on missing resource rejected: %v", err)
+	}
+}
@@ -1,17 +1,51 @@
 package wserver
 
 import (
-	"encoding/json"
+	. "github.com/fitmewell/wserver/log"
 	"io/ioutil"
+	"os"
 )
 
 func NewConfig(path string) (*ServerConfig, error) {
+	return NewProfileConfig(path, "")
+}
+
+//load path merged with the overlay of profile next to it , such as config.prod.json for config.json ,
+//an empty profile falls back to WSERVER_PROFILE and then to the Profile of the base file
+func NewProfileConfig(path string, profile string) (*ServerConfig, error) {
 	config := &ServerConfig{}
 	file, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	err = json.Unmarshal(file, &config)
+	err = decodeConfig(path, file, config)
+	if err != nil {
+		return nil, err
+	}
+	if profile == "" {
+		profile = os.Getenv(profileEnv)
+	}
+	if profile == "" {
+		profile = config.Profile
+	}
+	if profile != "" {
+		overlayPath := profileConfigPath(path, profile)
+		overlay, err := ioutil.ReadFile(overlayPath)
+		switch {
+		case os.IsNotExist(err):
+			Debug("no config for profile " + profile + ": " + overlayPath)
+		case err != nil:
+			return nil, err
+		default:
+			Debug("loading profile config file: " + overlayPath)
+			config, err = mergeConfig(path, file, overlayPath, overlay)
+			if err != nil {
+				return nil, err
+			}
+		}
+		config.Profile = profile
+	}
+	err = applyEnvironment(config, os.Environ())
 	if err != nil {
 		return nil, err
 	}
@@ -36,6 +70,42 @@ type SSLConfig struct {
 	SSLPort  string
 	CertFile string
 	KeyFile  string
+	//extra certificates picked by SNI
+	Certificates []Certificate
+	//lowest tls version accepted , 1.0 , 1.1 , 1.2 (default) or 1.3
+	MinVersion string
+	//cipher suite names as listed by crypto/tls , empty uses the go defaults
+	CipherSuites []string
+	//ca bundle verifying client certificates , turns on require_and_verify
+	ClientCAFile string
+	//none , request , require , verify_if_given or require_and_verify
+	ClientAuth string
+	//interval checking the certificate files and reloading changed ones , such as "1m" , empty disables
+	ReloadInterval string
+	Redirect       Redirect
+	DevCertificate DevCertificate
+}
+
+//certificate signed by a local CA , used when CertFile or KeyFile is missing , refused in the prod profile
+type DevCertificate struct {
+	Enable bool
+	//cache of the CA and the certificate , default the wserver/devcert user cache dir
+	Dir string
+	//names or ips besides localhost , 127.0.0.1 and ::1
+	Hosts []string
+}
+
+type Certificate struct {
+	CertFile string
+	KeyFile  string
+}
+
+//redirect of the plain http Port to https , HSTS is set by SecurityHeaders
+type Redirect struct {
+	//https port of the redirect target , default SSLPort
+	Port string
+	//302/307 instead of 301/308
+	Temporary bool
 }
 
 type StaticResource struct {
@@ -62,6 +132,8 @@ type PropertiesFile struct {
 	Locate string
 }
 type ServerConfig struct {
+	//active profile such as dev , test or prod , used when WSERVER_PROFILE is not set
+	Profile          string
 	Port             string
 	UseSSL           bool
 	SSLConfig        SSLConfig
@@ -70,8 +142,175 @@ type ServerConfig struct {
 	Templates        []Template
 	PropertiesConfig PropertiesConfig
 	Session          Session
+	Timeout          Timeout
+	SecurityHeaders  SecurityHeaders
+	Csrf             Csrf
+	ResponseCache    ResponseCache
+	//cidrs or ips of proxies whose X-Forwarded-* and Forwarded headers are believed
+	TrustedProxies []string
+	AccessRules    []AccessRule
+	Maintenance    Maintenance
+	Shutdown       Shutdown
+	Health         Health
+	//listeners replacing Port and SSLConfig.SSLPort when set
+	Listeners  []Listener
+	HotRestart HotRestart
+	HTTP2      HTTP2
+	HotReload  HotReload
+	//debug (default) or error , error hides the debug output , process wide and applied by Start and Reload
+	LogLevel string
+	//skip installing the signal handlers , for servers embedded in libraries and tests
+	DisableSignals bool
+	//add an ETag hashed from the body to GET responses written from handler results
+	AutoETag bool
 }
 
 type Session struct {
 	CookieName string
 }
+
+//request deadlines, durations use time.ParseDuration format such as "30s" , empty means no deadline ,
+//the request is answered 504 when its handler did not finish in time , the handler should watch the context to stop
+type Timeout struct {
+	Default string
+	Routes  []RouteTimeout
+}
+
+//deadline for requests whose path is Path or lies below it , /api covers /api/users but not /apiv2 , a trailing * or ** is ignored
+type RouteTimeout struct {
+	Path    string
+	Timeout string
+}
+
+//security headers added to every response when Enable is set , empty fields fall back to safe defaults
+type SecurityHeaders struct {
+	Enable bool
+	//HSTS is only sent to clients using https , directly or through a trusted proxy , default max age is one year
+	HSTSMaxAge            int
+	HSTSIncludeSubDomains bool
+	HSTSPreload           bool
+	//policy sent as Content-Security-Policy , each {nonce} is replaced by a per request nonce
+	ContentSecurityPolicy string
+	//set true to skip X-Content-Type-Options: nosniff
+	DisableNoSniff    bool
+	FrameOptions      string
+	ReferrerPolicy    string
+	PermissionsPolicy string
+}
+
+//csrf protection for unsafe methods , the token lives in the session
+type Csrf struct {
+	Enable bool
+	//form field carrying the token , default csrf_token
+	FieldName string
+	//header carrying the token , default X-CSRF-Token
+	HeaderName string
+	//path prefixes skipping the check , such as webhooks
+	ExcludePaths []string
+}
+
+//server side cache of GET/HEAD responses , only the listed routes are cached
+type ResponseCache struct {
+	//limits of the in memory LRU , zero uses 1000 entries , 64MB in total and 1MB per response
+	MaxEntries    int
+	MaxBytes      int
+	MaxEntryBytes int
+	Routes        []CacheRoute
+}
+
+//cache responses under Path for TTL , VaryHeaders are request headers added to the cache key
+type CacheRoute struct {
+	Path        string
+	TTL         string
+	VaryHeaders []string
+}
+
+//ip rules for requests under Path , a client in Deny or missing from a non empty Allow gets 403
+type AccessRule struct {
+	Path  string
+	Allow []string
+	Deny  []string
+}
+
+//maintenance mode answering 503 , it can also be switched at runtime by Server.SetMaintenance ,
+//the wserver.maintenance property or SIGUSR1
+type Maintenance struct {
+	Enable bool
+	//route groups under maintenance , empty means the whole server
+	Paths []string
+	//paths kept working , such as health checks
+	ExcludePaths []string
+	//ips or cidrs still served
+	Allow []string
+	//sent as Retry-After , such as "10m"
+	RetryAfter string
+	//template rendering the maintenance page , RetryAfter is available in its data
+	Template string
+}
+
+//graceful shutdown deadlines , durations such as "10s" , empty means 10 seconds
+type Shutdown struct {
+	//time given to in-flight requests to finish
+	Timeout string
+	//default time given to each aftermath
+	AftermathTimeout string
+	//time the readiness endpoint reports failing before draining starts , empty means none ,
+	//at most half of Timeout so the requests still get drained
+	ReadinessDelay string
+}
+
+//built-in health endpoints , they keep working during maintenance
+type Health struct {
+	Enable bool
+	//always ok while the process runs , default /livez
+	LivenessPath string
+	//runs the db , session and registered checks , default /healthz
+	HealthPath string
+	//like HealthPath but also fails before the server serves and during shutdown , default /readyz
+	ReadinessPath string
+	//deadline of the checks , default 5s
+	Timeout string
+}
+
+//a socket the server serves on
+type Listener struct {
+	Name string
+	//tcp (default) , tcp4 , tcp6 , unix or systemd for a socket inherited through LISTEN_FDS
+	Network string
+	//such as ":8080" , "127.0.0.1:9090" , "/run/app.sock" , or the name or index of a systemd socket
+	Address string
+	UseSSL  bool
+	//default to SSLConfig when empty
+	CertFile string
+	KeyFile  string
+	//path prefixes served on this listener , empty means every route
+	Paths        []string
+	ExcludePaths []string
+}
+
+//zero downtime restart , SIGUSR2 starts the new binary on the listening sockets and this process
+//drains once the child serves
+type HotRestart struct {
+	Enable bool
+	//time the child has to get ready , default 30s
+	ReadyTimeout string
+}
+
+//http/2 settings , tls listeners negotiate http/2 by default
+type HTTP2 struct {
+	//serve cleartext http/2 with prior knowledge on the plain listeners , for servers behind a tls terminating proxy
+	H2C bool
+	//zero uses the net/http defaults
+	MaxConcurrentStreams uint32
+	MaxReadFrameSize     uint32
+	//idle time before a connection is closed , http/1 keep-alive connections included
+	IdleTimeout string
+}
+
+//poll the config file , properties files and template dirs and reload properties , templates ,
+//static resources and LogLevel when they change
+type HotReload struct {
+	Enable bool
+	//default 2s
+	Interval string
+}
@@ -0,0 +1,426 @@
+package wserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//decode a config file into v according to its extension , yaml and toml documents are turned into json
+//first so every format fills ServerConfig the same way (case insensitive field names , same types)
+func decodeConfig(path string, data []byte, v interface{}) error {
+	data, original, err := configJSON(data, path, reflect.TypeOf(v))
+	if err == nil {
+		err = unmarshalJSON(data, v, original)
+	}
+	if err != nil {
+		return errors.New(path + ": " + err.Error())
+	}
+	return nil
+}
+
+//the json form of a config file for a value of type t , original tells whether offsets in it are those of the file
+func configJSON(data []byte, path string, t reflect.Type) ([]byte, bool, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		data, err := yamlToJSON(data, t)
+		return data, false, err
+	case ".toml":
+		data, err := tomlToJSON(data, t)
+		return data, false, err
+	}
+	//.json and .jsonc accept // and /* */ comments plus trailing commas
+	return stripJSONComments(data), true, nil
+}
+
+func yamlToJSON(data []byte, t reflect.Type) ([]byte, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	node, err := yamlConfigNode(&root)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := node.jsonValue(t, "")
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+func tomlToJSON(data []byte, t reflect.Type) ([]byte, error) {
+	doc := map[string]interface{}{}
+	if _, err := toml.Decode(string(data), &doc); err != nil {
+		var parseErr toml.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, fmt.Errorf("line %d column %d: %s", parseErr.Position.Line, parseErr.Position.Col, parseErr.Message)
+		}
+		return nil, err
+	}
+	lines := strings.Split(string(data), "\n")
+	value, err := tomlConfigNode(doc, nil, lines).jsonValue(t, "")
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+//a yaml or toml value with the position it was written at , line is 0 when it is not known
+type configNode struct {
+	kind   yaml.Kind
+	value  interface{} //decoded scalar , nil for null
+	text   string      //scalar as written
+	keys   []string
+	fields []*configNode
+	items  []*configNode
+	line   int
+	column int
+}
+
+func yamlConfigNode(node *yaml.Node) (*configNode, error) {
+	for node.Kind == yaml.DocumentNode && len(node.Content) == 1 {
+		node = node.Content[0]
+	}
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	n := &configNode{kind: node.Kind, line: node.Line, column: node.Column}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			value, err := yamlConfigNode(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			//<<: *base merges the keys of the aliased mappings
+			if node.Content[i].Tag == "!!merge" {
+				merged := []*configNode{value}
+				if value.kind == yaml.SequenceNode {
+					merged = value.items
+				}
+				for _, m := range merged {
+					n.keys = append(n.keys, m.keys...)
+					n.fields = append(n.fields, m.fields...)
+				}
+				continue
+			}
+			n.keys = append(n.keys, node.Content[i].Value)
+			n.fields = append(n.fields, value)
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			value, err := yamlConfigNode(item)
+			if err != nil {
+				return nil, err
+			}
+			n.items = append(n.items, value)
+		}
+	case yaml.ScalarNode:
+		n.text = node.Value
+		if err := node.Decode(&n.value); err != nil {
+			return nil, fmt.Errorf("line %d column %d: %s", node.Line, node.Column, err.Error())
+		}
+	default:
+		//empty document
+		n.kind = yaml.ScalarNode
+	}
+	return n, nil
+}
+
+//toml values do not carry their position , it is looked up in lines from the key path
+func tomlConfigNode(value interface{}, path []interface{}, lines []string) *configNode {
+	n := &configNode{kind: yaml.ScalarNode, value: value}
+	n.line, n.column = tomlPosition(lines, path)
+	switch v := value.(type) {
+	case map[string]interface{}:
+		n.kind = yaml.MappingNode
+		for key, item := range v {
+			n.keys = append(n.keys, key)
+			n.fields = append(n.fields, tomlConfigNode(item, append(path[:len(path):len(path)], key), lines))
+		}
+	case []map[string]interface{}:
+		n.kind = yaml.SequenceNode
+		for i, item := range v {
+			n.items = append(n.items, tomlConfigNode(item, append(path[:len(path):len(path)], i), lines))
+		}
+	case []interface{}:
+		n.kind = yaml.SequenceNode
+		for i, item := range v {
+			n.items = append(n.items, tomlConfigNode(item, append(path[:len(path):len(path)], i), lines))
+		}
+	case string:
+		n.text = v
+	case float64:
+		n.text = strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		n.text = fmt.Sprint(v)
+	}
+	return n
+}
+
+//line and column of the value at path (keys and list indexes) , tables are found by their header and
+//the n-th [[header]] for arrays of tables , 0 when the key is not written on a line of its own
+func tomlPosition(lines []string, path []interface{}) (int, int) {
+	key, table, index := "", []string{}, 0
+	for _, part := range path {
+		switch p := part.(type) {
+		case string:
+			if key != "" {
+				table = append(table, key)
+			}
+			key = p
+		case int:
+			index = p
+		}
+	}
+	if key == "" {
+		return 0, 0
+	}
+	header := strings.ToLower(strings.Join(table, "."))
+	current, currentIndex, seen := "", 0, map[string]int{}
+	for i, line := range lines {
+		text := strings.TrimSpace(line)
+		if strings.HasPrefix(text, "[") {
+			if comment := strings.Index(text, "#"); comment >= 0 {
+				text = text[:comment]
+			}
+			current = strings.ToLower(strings.Trim(text, "[] \t"))
+			currentIndex = seen[current]
+			seen[current]++
+			continue
+		}
+		name, _, ok := strings.Cut(text, "=")
+		if !ok || current != header || currentIndex != index ||
+			!strings.EqualFold(strings.Trim(strings.TrimSpace(name), `"'`), key) {
+			continue
+		}
+		column := strings.Index(line, "=") + 1
+		for column < len(line) && (line[column] == ' ' || line[column] == '\t') {
+			column++
+		}
+		return i + 1, column + 1
+	}
+	return 0, 0
+}
+
+//the json value of n for a value of type t , scalars are converted to the type so unquoted numbers fill
+//strings like port: 8080 , t is nil for keys ServerConfig does not have which are kept as they are
+func (n *configNode) jsonValue(t reflect.Type, field string) (interface{}, error) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	dynamic := t == nil || t.Kind() == reflect.Interface
+	switch n.kind {
+	case yaml.MappingNode:
+		if !dynamic && t.Kind() != reflect.Struct && t.Kind() != reflect.Map {
+			return nil, n.typeError(t, field)
+		}
+		m := make(map[string]interface{}, len(n.keys))
+		for i, key := range n.keys {
+			var fieldType reflect.Type
+			name := key
+			if !dynamic && t.Kind() == reflect.Map {
+				fieldType = t.Elem()
+			} else if !dynamic {
+				if f, ok := foldField(t, key); ok {
+					fieldType, name = f.Type, f.Name
+				}
+			}
+			if field != "" {
+				name = field + "." + name
+			}
+			value, err := n.fields[i].jsonValue(fieldType, name)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+	case yaml.SequenceNode:
+		if !dynamic && t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return nil, n.typeError(t, field)
+		}
+		var itemType reflect.Type
+		if !dynamic {
+			itemType = t.Elem()
+		}
+		list := make([]interface{}, len(n.items))
+		for i, item := range n.items {
+			value, err := item.jsonValue(itemType, fmt.Sprintf("%s[%d]", field, i))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = value
+		}
+		return list, nil
+	}
+	if dynamic || n.value == nil {
+		return n.value, nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return n.text, nil
+	case reflect.Bool:
+		if b, ok := n.value.(bool); ok {
+			return b, nil
+		}
+		if b, err := strconv.ParseBool(n.text); err == nil {
+			return b, nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, err := strconv.ParseInt(n.text, 10, 64); err == nil && !reflect.New(t).Elem().OverflowInt(i) {
+			return i, nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if u, err := strconv.ParseUint(n.text, 10, 64); err == nil && !reflect.New(t).Elem().OverflowUint(u) {
+			return u, nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, err := strconv.ParseFloat(n.text, 64); err == nil {
+			return f, nil
+		}
+	}
+	return nil, n.typeError(t, field)
+}
+
+//same message as the json type errors , with the position when it is known
+func (n *configNode) typeError(t reflect.Type, field string) error {
+	got := "string"
+	switch n.value.(type) {
+	case bool:
+		got = "bool"
+	case int, int64, uint64, float64:
+		got = "number"
+	}
+	switch n.kind {
+	case yaml.MappingNode:
+		got = "object"
+	case yaml.SequenceNode:
+		got = "array"
+	}
+	message := fmt.Sprintf("%s must be %s , got %s %q", field, t, got, n.text)
+	if n.kind != yaml.ScalarNode {
+		message = fmt.Sprintf("%s must be %s , got %s", field, t, got)
+	}
+	if n.line == 0 {
+		return errors.New(message)
+	}
+	return fmt.Errorf("line %d column %d: %s", n.line, n.column, message)
+}
+
+//struct field matching a key the way encoding/json does , exact name first then case insensitively
+func foldField(t reflect.Type, key string) (reflect.StructField, bool) {
+	if f, ok := t.FieldByName(key); ok && f.IsExported() {
+		return f, true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.IsExported() && strings.EqualFold(f.Name, key) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+//json.Unmarshal with the line and column of syntax and type errors when data is the original file
+func unmarshalJSON(data []byte, v interface{}, position bool) error {
+	err := json.Unmarshal(data, v)
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		line, column := lineColumn(data, syntaxErr.Offset-1)
+		return fmt.Errorf("line %d column %d: %s", line, column, syntaxErr.Error())
+	case errors.As(err, &typeErr):
+		message := fmt.Sprintf("%s must be %s , got %s", typeErr.Field, typeErr.Type, typeErr.Value)
+		if !position {
+			return errors.New(message)
+		}
+		line, column := lineColumn(data, typeErr.Offset)
+		return fmt.Errorf("line %d column %d: %s", line, column, message)
+	}
+	return err
+}
+
+func lineColumn(data []byte, offset int64) (line int, column int) {
+	line, column = 1, 1
+	for i := int64(0); i < offset && i < int64(len(data)); i++ {
+		if data[i] == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return line, column
+}
+
+//blank out comments and trailing commas , keeping offsets so errors point at the original text
+func stripJSONComments(data []byte) []byte {
+	out := make([]byte, len(data))
+	copy(out, data)
+	scanJSON(out, func(i int) int {
+		if out[i] != '/' || i+1 >= len(out) {
+			return i
+		}
+		switch out[i+1] {
+		case '/':
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+			return i - 1
+		case '*':
+			end := i + 2
+			for end+1 < len(out) && !(out[end] == '*' && out[end+1] == '/') {
+				end++
+			}
+			end = end + 2
+			if end > len(out) {
+				end = len(out)
+			}
+			for ; i < end; i++ {
+				if out[i] != '\n' {
+					out[i] = ' '
+				}
+			}
+			return i - 1
+		}
+		return i
+	})
+	scanJSON(out, func(i int) int {
+		if out[i] != ',' {
+			return i
+		}
+		j := i + 1
+		for j < len(out) && (out[j] == ' ' || out[j] == '\t' || out[j] == '\n' || out[j] == '\r') {
+			j++
+		}
+		if j < len(out) && (out[j] == '}' || out[j] == ']') {
+			out[i] = ' '
+		}
+		return i
+	})
+	return out
+}
+
+//call visit with the offset of every byte outside string literals , visit returns the last offset it consumed
+func scanJSON(data []byte, visit func(i int) int) {
+	inString := false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case inString && c == '\\':
+			i++
+		case c == '"':
+			inString = !inString
+		case !inString:
+			i = visit(i)
+		}
+	}
+}
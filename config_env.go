@@ -0,0 +1,216 @@
+package wserver
+
+import (
+	"errors"
+	. "github.com/fitmewell/wserver/log"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//prefix of the environment variables overriding loaded config values
+const envOverridePrefix = "WSERVER_"
+
+//WSERVER_ variables of the server itself which are not config overrides
+var envOverrideReserved = map[string]bool{
+	readyFdEnv: true,
+	profileEnv: true,
+}
+
+//expand ${VAR} and ${VAR:default} in every string of config , then apply the WSERVER_ overrides of environ
+func applyEnvironment(config *ServerConfig, environ []string) error {
+	var errs []error
+	interpolateValue(reflect.ValueOf(config).Elem(), "", &errs)
+
+	sort.Strings(environ)
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, envOverridePrefix) || envOverrideReserved[name] {
+			continue
+		}
+		path := strings.Split(strings.TrimPrefix(name, envOverridePrefix), "_")
+		err := setConfigPath(reflect.ValueOf(config).Elem(), path, value)
+		var unknown unknownFieldError
+		switch {
+		case errors.As(err, &unknown):
+			//variables of other tools may share the prefix , they are only logged
+			DebugF("ignore %s: unknown field %s", name, string(unknown))
+		case err != nil:
+			errs = append(errs, errors.New(name+": "+err.Error()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func interpolateValue(v reflect.Value, path string, errs *[]error) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			interpolateValue(v.Elem(), path, errs)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.IsExported() {
+				interpolateValue(v.Field(i), joinConfigPath(path, field.Name), errs)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			interpolateValue(v.Index(i), path+"["+strconv.Itoa(i)+"]", errs)
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			return
+		}
+		for _, key := range v.MapKeys() {
+			expanded, err := interpolate(v.MapIndex(key).String())
+			if err != nil {
+				*errs = append(*errs, errors.New(path+"["+key.String()+"]: "+err.Error()))
+				continue
+			}
+			v.SetMapIndex(key, reflect.ValueOf(expanded).Convert(v.Type().Elem()))
+		}
+	case reflect.String:
+		expanded, err := interpolate(v.String())
+		if err != nil {
+			*errs = append(*errs, errors.New(path+": "+err.Error()))
+			return
+		}
+		v.SetString(expanded)
+	}
+}
+
+func joinConfigPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+//replace ${VAR} by the environment variable VAR , ${VAR:default} uses default when VAR is unset ,
+//$${ is kept as a literal ${
+func interpolate(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if start > 0 && s[start-1] == '$' {
+			b.WriteString(s[:start-1] + "${")
+			s = s[start+2:]
+			continue
+		}
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
+			return "", errors.New("unclosed ${ in " + strconv.Quote(s))
+		}
+		b.WriteString(s[:start])
+		name, fallback, hasDefault := strings.Cut(s[start+2:start+end], ":")
+		value, ok := os.LookupEnv(name)
+		switch {
+		case ok:
+			b.WriteString(value)
+		case hasDefault:
+			b.WriteString(fallback)
+		default:
+			return "", errors.New("environment variable " + name + " is not set")
+		}
+		s = s[start+end+1:]
+	}
+}
+
+type unknownFieldError string
+
+func (e unknownFieldError) Error() string {
+	return "unknown field " + string(e)
+}
+
+//set the field found by following path , struct fields match case insensitively , slices take an index
+//(the next index appends) and maps the rest of the path as key
+func setConfigPath(v reflect.Value, path []string, value string) error {
+	if len(path) == 0 {
+		return setConfigValue(v, value)
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setConfigPath(v.Elem(), path, value)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.IsExported() && strings.EqualFold(field.Name, path[0]) {
+				return setConfigPath(v.Field(i), path[1:], value)
+			}
+		}
+		return unknownFieldError(path[0])
+	case reflect.Slice:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i > v.Len() {
+			return errors.New("invalid index " + path[0])
+		}
+		if i == v.Len() {
+			v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+		}
+		return setConfigPath(v.Index(i), path[1:], value)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String || v.Type().Elem().Kind() != reflect.String {
+			return errors.New("unsupported map")
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		v.SetMapIndex(reflect.ValueOf(strings.Join(path, "_")).Convert(v.Type().Key()), reflect.ValueOf(value).Convert(v.Type().Elem()))
+		return nil
+	}
+	return errors.New("can not set " + strings.Join(path, "_") + " of a " + v.Kind().String())
+}
+
+func setConfigValue(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(i)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return errors.New("can not set a list of " + v.Type().Elem().Kind().String())
+		}
+		//comma separated list replacing the loaded one
+		items := reflect.MakeSlice(v.Type(), 0, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = reflect.Append(items, reflect.ValueOf(item).Convert(v.Type().Elem()))
+			}
+		}
+		v.Set(items)
+	default:
+		return errors.New("can not set a " + v.Kind().String())
+	}
+	return nil
+}
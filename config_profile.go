@@ -0,0 +1,171 @@
+package wserver
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+//environment variable choosing the config profile
+const profileEnv = "WSERVER_PROFILE"
+
+//profile of config , the one it was loaded with or WSERVER_PROFILE ,
+//NewProfileConfig resolves the profile argument , then WSERVER_PROFILE , then Profile of the file into Profile
+func activeProfile(config *ServerConfig) string {
+	if config.Profile != "" {
+		return config.Profile
+	}
+	return os.Getenv(profileEnv)
+}
+
+//prod in Profile or in WSERVER_PROFILE , whichever wins , for guards like the development certificate
+func productionProfile(config *ServerConfig) (string, bool) {
+	for _, profile := range []string{config.Profile, os.Getenv(profileEnv)} {
+		if isProductionProfile(profile) {
+			return profile, true
+		}
+	}
+	return "", false
+}
+
+func isProductionProfile(profile string) bool {
+	profile = strings.ToLower(profile)
+	return profile == "prod" || profile == "production"
+}
+
+//config.json with profile prod is config.prod.json
+func profileConfigPath(path string, profile string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + profile + ext
+}
+
+//deep merge the overlay file into the base file , both may use any supported format
+func mergeConfig(path string, data []byte, overlayPath string, overlay []byte) (*ServerConfig, error) {
+	//decoding the overlay alone reports its errors with their position
+	if err := decodeConfig(overlayPath, overlay, &ServerConfig{}); err != nil {
+		return nil, err
+	}
+	base, err := configDocument(path, data)
+	if err != nil {
+		return nil, err
+	}
+	layer, err := configDocument(overlayPath, overlay)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := json.Marshal(mergeDocuments(base, layer, reflect.TypeOf(ServerConfig{})))
+	if err != nil {
+		return nil, err
+	}
+	config := &ServerConfig{}
+	if err := unmarshalJSON(merged, config, false); err != nil {
+		return nil, errors.New(path + " with " + overlayPath + ": " + err.Error())
+	}
+	return config, nil
+}
+
+func configDocument(path string, data []byte) (interface{}, error) {
+	data, _, err := configJSON(data, path, reflect.TypeOf(ServerConfig{}))
+	var doc interface{}
+	if err == nil {
+		err = json.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		return nil, errors.New(path + ": " + err.Error())
+	}
+	return doc, nil
+}
+
+//objects are merged key by key , keys of the structs of t match case insensitively like the config fields ,
+//keys of maps such as the properties exactly , lists whose entries all have a Name are merged entry by entry ,
+//any other value of overlay replaces the base one
+func mergeDocuments(base interface{}, overlay interface{}, t reflect.Type) interface{} {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch layer := overlay.(type) {
+	case map[string]interface{}:
+		m, ok := base.(map[string]interface{})
+		if !ok {
+			return overlay
+		}
+		for key, value := range layer {
+			existing, found, child := key, false, reflect.Type(nil)
+			if t != nil && t.Kind() == reflect.Map {
+				_, found = m[key]
+				child = t.Elem()
+			} else {
+				existing, found = lookupFold(m, key)
+				if t != nil && t.Kind() == reflect.Struct {
+					if f, ok := foldField(t, key); ok {
+						child = f.Type
+					}
+				}
+			}
+			if found {
+				m[existing] = mergeDocuments(m[existing], value, child)
+			} else {
+				m[key] = value
+			}
+		}
+		return m
+	case []interface{}:
+		list, ok := base.([]interface{})
+		if !ok || !namedEntries(list) || !namedEntries(layer) {
+			return overlay
+		}
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		}
+		for _, entry := range layer {
+			merged := false
+			for i, existing := range list {
+				if entryName(existing) == entryName(entry) {
+					list[i] = mergeDocuments(existing, entry, elem)
+					merged = true
+					break
+				}
+			}
+			if !merged {
+				list = append(list, entry)
+			}
+		}
+		return list
+	}
+	return overlay
+}
+
+func lookupFold(m map[string]interface{}, key string) (string, bool) {
+	if _, ok := m[key]; ok {
+		return key, true
+	}
+	for k := range m {
+		if strings.EqualFold(k, key) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+func entryName(entry interface{}) string {
+	if m, ok := entry.(map[string]interface{}); ok {
+		if key, found := lookupFold(m, "Name"); found {
+			name, _ := m[key].(string)
+			return name
+		}
+	}
+	return ""
+}
+
+func namedEntries(list []interface{}) bool {
+	for _, entry := range list {
+		if entryName(entry) == "" {
+			return false
+		}
+	}
+	return true
+}
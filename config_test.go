@@ -0,0 +1,234 @@
+package wserver
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecodeConfigFormats(t *testing.T) {
+	documents := map[string]string{
+		"config.json": `{
+  "Port": "8080", // plain http
+  /* the databases */
+  "Databases": [{"Name": "RW", "MaxConnections": 30, "DriverName": "mysql",},],
+}`,
+		"config.yaml": `
+port: 8080
+databases:
+  - name: RW
+    maxConnections: 30
+    driverName: mysql
+`,
+		"config.toml": `
+Port = 8080
+[[Databases]]
+Name = "RW"
+MaxConnections = 30
+DriverName = "mysql"
+`,
+	}
+	for path, document := range documents {
+		config := &ServerConfig{}
+		if err := decodeConfig(path, []byte(document), config); err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if config.Port != "8080" || len(config.Databases) != 1 || config.Databases[0].Name != "RW" ||
+			config.Databases[0].MaxConnections != 30 || config.Databases[0].DriverName != "mysql" {
+			t.Errorf("%s decoded to %+v", path, config)
+		}
+	}
+}
+
+func TestDecodeConfigErrors(t *testing.T) {
+	cases := map[string]string{
+		"config.json":  "{\n  \"Port\": \"8080\",\n  \"UseSSL\": yes\n}",
+		"config.jsonc": "{\n  \"Port\": 8080\n}",
+		"config.yaml":  "port: 8080\n  useSSL: true\n",
+		"config.toml":  "Port = \"8080\"\nUseSSL = \n",
+		"types.yaml":   "port: 8080\nuseSSL: maybe\n",
+		"types.yml":    "databases:\n  - name: RW\n    maxConnections: many\n",
+		"types.toml":   "Port = 8080\n\n[[Databases]]\nName = \"RO\"\n[[Databases]]\nName = \"RW\"\nMaxConnections =  \"many\"\n",
+	}
+	expected := map[string]string{
+		"config.json":  "line 3 column 13",
+		"config.jsonc": "line 2 column",
+		"config.yaml":  "line 2",
+		"config.toml":  "line 2",
+		"types.yaml":   "line 2 column 9: UseSSL must be bool",
+		"types.yml":    "line 3 column 21: Databases[0].MaxConnections must be int",
+		"types.toml":   "line 7 column 19: Databases[1].MaxConnections must be int",
+	}
+	for path, document := range cases {
+		err := decodeConfig(path, []byte(document), &ServerConfig{})
+		if err == nil || !strings.Contains(err.Error(), expected[path]) || !strings.HasPrefix(err.Error(), path) {
+			t.Errorf("%s: expected error at %s, got %v", path, expected[path], err)
+		}
+	}
+}
+
+func TestStripJSONComments(t *testing.T) {
+	in := `{"url": "http://host/*x*/", "a": 1, /* c */ "b": [1, 2, // c
+]}`
+	out := string(stripJSONComments([]byte(in)))
+	if len(out) != len(in) || !strings.Contains(out, `"http://host/*x*/"`) || strings.Contains(out, "c */") || strings.Contains(out, "2,") {
+		t.Errorf("unexpected result %q", out)
+	}
+}
+
+func TestApplyEnvironment(t *testing.T) {
+	t.Setenv("DB_PASS", "secret")
+	config := &ServerConfig{
+		Port:      "${PORT_NOT_SET:8080}",
+		Databases: []Database{{Name: "RW", Password: "${DB_PASS}"}},
+		PropertiesConfig: PropertiesConfig{Properties: map[string]string{
+			"url":     "http://${HOST_NOT_SET:localhost}:${PORT_NOT_SET:80}/",
+			"literal": "$${DB_PASS}",
+		}},
+	}
+	environ := []string{
+		"WSERVER_USESSL=true",
+		"WSERVER_SSLCONFIG_SSLPORT=8443",
+		"WSERVER_DATABASES_0_MAXCONNECTIONS=5",
+		"WSERVER_DATABASES_1_NAME=RO",
+		"WSERVER_TRUSTEDPROXIES=10.0.0.0/8, 192.168.0.1",
+		"WSERVER_PROPERTIESCONFIG_PROPERTIES_mail_host=smtp",
+		"WSERVER_READY_FD=3",
+		"OTHER=1",
+	}
+	if err := applyEnvironment(config, environ); err != nil {
+		t.Fatal(err)
+	}
+	properties := config.PropertiesConfig.Properties
+	if config.Port != "8080" || config.Databases[0].Password != "secret" ||
+		properties["url"] != "http://localhost:80/" || properties["literal"] != "${DB_PASS}" {
+		t.Errorf("unexpected interpolation %+v", config)
+	}
+	if !config.UseSSL || config.SSLConfig.SSLPort != "8443" || config.Databases[0].MaxConnections != 5 ||
+		len(config.Databases) != 2 || config.Databases[1].Name != "RO" ||
+		len(config.TrustedProxies) != 2 || properties["mail_host"] != "smtp" {
+		t.Errorf("unexpected overrides %+v", config)
+	}
+
+	ignored := &ServerConfig{}
+	if err := applyEnvironment(ignored, []string{"WSERVER_NOPE=1", "WSERVER_SSLCONFIG_NOPE=1", "WSERVER_PROFILE=prod"}); err != nil {
+		t.Errorf("unknown and reserved variables should be ignored, got %v", err)
+	}
+	if ignored.Profile != "" {
+		t.Errorf("reserved variable applied to Profile %q", ignored.Profile)
+	}
+
+	err := applyEnvironment(&ServerConfig{Port: "${PORT_NOT_SET}"}, []string{"WSERVER_USESSL=maybe", "WSERVER_DATABASES_3_NAME=x"})
+	for _, expected := range []string{"Port: environment variable PORT_NOT_SET is not set", "WSERVER_USESSL: strconv.ParseBool", "WSERVER_DATABASES_3_NAME: invalid index"} {
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in %v", expected, err)
+		}
+	}
+}
+
+func TestProfileConfig(t *testing.T) {
+	dir := t.TempDir()
+	base := `{
+  "Port": "8080",
+  "Profile": "dev",
+  "Databases": [{"Name": "RW", "Address": "127.0.0.1", "Password": "dev"}, {"Name": "RO", "Address": "127.0.0.1"}],
+  "TrustedProxies": ["127.0.0.1"],
+  "PropertiesConfig": {"Properties": {"a": "1", "b": "2", "Mail.Host": "base"}}
+}`
+	overlay := `{
+  "port": "80",
+  "databases": [{"name": "RW", "address": "db.internal"}, {"name": "Report", "address": "report.internal"}],
+  "trustedProxies": ["10.0.0.0/8"],
+  "propertiesConfig": {"properties": {"b": "3", "mail.host": "overlay"}}
+}`
+	for name, content := range map[string]string{"config.json": base, "config.prod.json": overlay, "config.test.json": `{"Port": "9090"}`} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config, err := NewProfileConfig(filepath.Join(dir, "config.json"), "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	databases := config.Databases
+	if config.Profile != "prod" || config.Port != "80" || len(databases) != 3 ||
+		databases[0].Address != "db.internal" || databases[0].Password != "dev" ||
+		databases[1].Address != "127.0.0.1" || databases[2].Name != "Report" ||
+		len(config.TrustedProxies) != 1 || config.TrustedProxies[0] != "10.0.0.0/8" ||
+		config.PropertiesConfig.Properties["a"] != "1" || config.PropertiesConfig.Properties["b"] != "3" {
+		t.Errorf("unexpected merge %+v", config)
+	}
+	if properties := config.PropertiesConfig.Properties; properties["Mail.Host"] != "base" || properties["mail.host"] != "overlay" {
+		t.Errorf("property keys should merge case sensitively, got %v", properties)
+	}
+
+	t.Setenv(profileEnv, "test")
+	if config, err = NewConfig(filepath.Join(dir, "config.json")); err != nil || config.Port != "9090" || config.Profile != "test" {
+		t.Errorf("expected the test profile from the environment, got %+v %v", config, err)
+	}
+	t.Setenv(profileEnv, "")
+	if config, err = NewConfig(filepath.Join(dir, "config.json")); err != nil || config.Port != "8080" || config.Profile != "dev" {
+		t.Errorf("expected the dev profile without overlay, got %+v %v", config, err)
+	}
+	for _, c := range []struct {
+		profile, env string
+		prod         bool
+	}{{"dev", "", false}, {"dev", "prod", true}, {"prod", "dev", true}, {"", "production", true}} {
+		t.Setenv(profileEnv, c.env)
+		if _, prod := productionProfile(&ServerConfig{Profile: c.profile}); prod != c.prod {
+			t.Errorf("Profile %q with %s=%q: expected prod %t", c.profile, profileEnv, c.env, c.prod)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	config := &ServerConfig{
+		Port:   "80a",
+		UseSSL: true,
+		SSLConfig: SSLConfig{
+			SSLPort:  "8443",
+			CertFile: filepath.Join(dir, "missing.crt"),
+		},
+		Databases: []Database{
+			{Name: "RW", DriverName: "mysql", IsDefault: true},
+			{Name: "RW", IsDefault: true},
+			{Name: "Orders", DriverName: "mysql", DbName: "orders"},
+			{Name: "OrdersCopy", DriverName: "mysql", DbName: "orders"},
+		},
+		Templates:       []Template{{Name: "default", Dir: filepath.Join(dir, "templates")}},
+		StaticResources: []StaticResource{{Path: "/static/**", FileLocate: dir}},
+		TrustedProxies:  []string{"10.0.0.0/33"},
+		Timeout:         Timeout{Default: "30"},
+	}
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("expected problems")
+	}
+	for _, expected := range []string{
+		`Port: invalid port "80a"`,
+		"SSLConfig.CertFile:",
+		"SSLConfig.KeyFile: is required",
+		"Databases[1].DriverName: is required",
+		"Databases[1].Name: duplicate database name RW",
+		`Databases[3].DbName: duplicate database "orders"`,
+		"Databases: 2 databases are IsDefault",
+		"Templates[0].Dir:",
+		"TrustedProxies:",
+		"Timeout.Default:",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in %v", expected, err)
+		}
+	}
+	if strings.Contains(err.Error(), "StaticResources") {
+		t.Errorf("existing static dir reported: %v", err)
+	}
+
+	if err := (&ServerConfig{Port: "8080"}).Validate(); err != nil {
+		t.Errorf("expected a valid config, got %v", err)
+	}
+}
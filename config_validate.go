@@ -0,0 +1,195 @@
+package wserver
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+)
+
+//check the config for problems which would otherwise show up while starting or serving ,
+//every problem found is returned at once
+func (config *ServerConfig) Validate() error {
+	v := &configValidator{}
+
+	v.port("Port", config.Port, false)
+	usesTLS := config.UseSSL && len(config.Listeners) == 0
+	if usesTLS {
+		v.port("SSLConfig.SSLPort", config.SSLConfig.SSLPort, true)
+	}
+	for i, listener := range config.Listeners {
+		path := "Listeners[" + strconv.Itoa(i) + "]"
+		if listener.Address == "" {
+			v.add(path+".Address", "is required")
+		}
+		switch listener.Network {
+		case "", "tcp", "tcp4", "tcp6", "unix", networkSystemd:
+		default:
+			v.add(path+".Network", "unknown network "+listener.Network)
+		}
+		if listener.UseSSL {
+			usesTLS = true
+			if listener.CertFile != "" || listener.KeyFile != "" {
+				v.file(path+".CertFile", listener.CertFile)
+				v.file(path+".KeyFile", listener.KeyFile)
+			}
+		}
+	}
+	if usesTLS {
+		ssl := config.SSLConfig
+		//missing files are generated with DevCertificate
+		if !ssl.DevCertificate.Enable {
+			v.file("SSLConfig.CertFile", ssl.CertFile)
+			v.file("SSLConfig.KeyFile", ssl.KeyFile)
+		}
+		for i, cert := range ssl.Certificates {
+			path := "SSLConfig.Certificates[" + strconv.Itoa(i) + "]"
+			v.file(path+".CertFile", cert.CertFile)
+			v.file(path+".KeyFile", cert.KeyFile)
+		}
+		if ssl.ClientCAFile != "" {
+			v.file("SSLConfig.ClientCAFile", ssl.ClientCAFile)
+		}
+		if _, ok := tlsVersions[ssl.MinVersion]; ssl.MinVersion != "" && !ok {
+			v.add("SSLConfig.MinVersion", "unknown tls version "+ssl.MinVersion)
+		}
+		if _, ok := clientAuthTypes[ssl.ClientAuth]; ssl.ClientAuth != "" && !ok {
+			v.add("SSLConfig.ClientAuth", "unknown client auth "+ssl.ClientAuth)
+		}
+		v.duration("SSLConfig.ReloadInterval", ssl.ReloadInterval)
+	}
+
+	names := map[string]bool{}
+	dbNames := map[string]bool{}
+	defaults := 0
+	for i, db := range config.Databases {
+		path := "Databases[" + strconv.Itoa(i) + "]"
+		if db.DriverName == "" {
+			v.add(path+".DriverName", "is required")
+		}
+		if db.Name != "" && names[db.Name] {
+			v.add(path+".Name", "duplicate database name "+db.Name)
+		}
+		names[db.Name] = true
+		//the pools are keyed by DbName , a second entry would replace the first
+		if dbNames[db.DbName] {
+			v.add(path+".DbName", "duplicate database "+strconv.Quote(db.DbName)+" , GetSelectDb reaches only one of them")
+		}
+		dbNames[db.DbName] = true
+		if db.IsDefault {
+			defaults++
+		}
+		if db.MaxConnections < 0 {
+			v.add(path+".MaxConnections", "must not be negative")
+		}
+	}
+	if defaults > 1 {
+		v.add("Databases", strconv.Itoa(defaults)+" databases are IsDefault , at most one may be")
+	}
+
+	for i, template := range config.Templates {
+		v.dir("Templates["+strconv.Itoa(i)+"].Dir", template.Dir)
+	}
+	for i, static := range config.StaticResources {
+		path := "StaticResources[" + strconv.Itoa(i) + "]"
+		if static.Path == "" {
+			v.add(path+".Path", "is required")
+		}
+		v.file(path+".FileLocate", static.FileLocate)
+	}
+	for i, pf := range config.PropertiesConfig.PropertiesFiles {
+		v.file("PropertiesConfig.PropertiesFiles["+strconv.Itoa(i)+"].Locate", pf.Locate)
+	}
+
+	if _, err := parseIPNets(config.TrustedProxies); err != nil {
+		v.add("TrustedProxies", err.Error())
+	}
+	for i, rule := range config.AccessRules {
+		path := "AccessRules[" + strconv.Itoa(i) + "]"
+		if _, err := parseIPNets(rule.Allow); err != nil {
+			v.add(path+".Allow", err.Error())
+		}
+		if _, err := parseIPNets(rule.Deny); err != nil {
+			v.add(path+".Deny", err.Error())
+		}
+	}
+	if _, err := parseIPNets(config.Maintenance.Allow); err != nil {
+		v.add("Maintenance.Allow", err.Error())
+	}
+
+	v.duration("Timeout.Default", config.Timeout.Default)
+	for i, route := range config.Timeout.Routes {
+		v.duration("Timeout.Routes["+strconv.Itoa(i)+"].Timeout", route.Timeout)
+	}
+	for i, route := range config.ResponseCache.Routes {
+		v.duration("ResponseCache.Routes["+strconv.Itoa(i)+"].TTL", route.TTL)
+	}
+	v.duration("Shutdown.Timeout", config.Shutdown.Timeout)
+	v.duration("Shutdown.AftermathTimeout", config.Shutdown.AftermathTimeout)
+	v.duration("Shutdown.ReadinessDelay", config.Shutdown.ReadinessDelay)
+	v.duration("Health.Timeout", config.Health.Timeout)
+	v.duration("HotRestart.ReadyTimeout", config.HotRestart.ReadyTimeout)
+	v.duration("HTTP2.IdleTimeout", config.HTTP2.IdleTimeout)
+	v.duration("HotReload.Interval", config.HotReload.Interval)
+	switch config.LogLevel {
+	case "", "debug", "error":
+	default:
+		v.add("LogLevel", "unknown log level "+config.LogLevel)
+	}
+
+	return errors.Join(v.errs...)
+}
+
+type configValidator struct {
+	errs []error
+}
+
+func (v *configValidator) add(field string, problem string) {
+	v.errs = append(v.errs, errors.New(field+": "+problem))
+}
+
+//empty ports are allowed unless required , "0" picks a free port
+func (v *configValidator) port(field string, value string, required bool) {
+	if value == "" {
+		if required {
+			v.add(field, "is required")
+		}
+		return
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 0 || port > 65535 {
+		v.add(field, "invalid port "+strconv.Quote(value))
+	}
+}
+
+func (v *configValidator) file(field string, path string) {
+	if path == "" {
+		v.add(field, "is required")
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		v.add(field, err.Error())
+	}
+}
+
+func (v *configValidator) dir(field string, path string) {
+	if path == "" {
+		v.add(field, "is required")
+		return
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		v.add(field, err.Error())
+	} else if !stat.IsDir() {
+		v.add(field, path+" is not a directory")
+	}
+}
+
+func (v *configValidator) duration(field string, value string) {
+	if value == "" {
+		return
+	}
+	if _, err := time.ParseDuration(value); err != nil {
+		v.add(field, err.Error())
+	}
+}
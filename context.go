@@ -2,13 +2,17 @@ package wserver
 
 import (
 	"database/sql"
+	"errors"
 	"github.com/fitmewell/wserver/bdb"
 	. "github.com/fitmewell/wserver/log"
 	"html/template"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 type ServerContext interface {
@@ -31,12 +35,106 @@ type ServerContext interface {
 	Init()
 }
 
+//config accessors beside the ServerContext methods , DefaultServerContext implements them and the hooks and
+//ServletContext offer them for any ServerContext , see configContext
+type ConfigContext interface {
+	ServerContext
+	//get property as int , def when it is missing or malformed
+	GetInt(key string, def int) int
+
+	//get property as bool (true , false , 1 , 0 ...) , def when it is missing or malformed
+	GetBool(key string, def bool) bool
+
+	//get property as duration such as 1m30s , def when it is missing or malformed
+	GetDuration(key string, def time.Duration) time.Duration
+
+	//get comma separated property , def when it is missing
+	GetStringSlice(key string, def []string) []string
+
+	//fill the struct target points to from the properties under prefix , see the prop tag
+	BindProperties(prefix string, target interface{}) error
+
+	//get the active config profile such as dev or prod , empty without profile
+	GetProfile() string
+
+	//register listener called after a reload changed properties , templates , static resources or the log level
+	AddChangeListener(func(ConfigChange))
+}
+
+//ConfigContext of serverContext , a context without the methods reads its properties through GetProperty ,
+//has no profile and is never reloaded
+func configContext(serverContext ServerContext) ConfigContext {
+	if config, ok := serverContext.(ConfigContext); ok {
+		return config
+	}
+	return propertyContext{serverContext}
+}
+
+type propertyContext struct {
+	ServerContext
+}
+
+func (c propertyContext) GetInt(key string, def int) int {
+	return propertyInt(c, key, def)
+}
+
+func (c propertyContext) GetBool(key string, def bool) bool {
+	return propertyBool(c, key, def)
+}
+
+func (c propertyContext) GetDuration(key string, def time.Duration) time.Duration {
+	return propertyDuration(c, key, def)
+}
+
+func (c propertyContext) GetStringSlice(key string, def []string) []string {
+	return propertyStringSlice(c, key, def)
+}
+
+func (c propertyContext) BindProperties(prefix string, target interface{}) error {
+	return bindProperties(c, prefix, target)
+}
+
+func (c propertyContext) GetProfile() string {
+	return ""
+}
+
+func (c propertyContext) AddChangeListener(func(ConfigChange)) {
+}
+
+//implemented by contexts whose init can fail such as DefaultServerContext , the server calls Open
+//instead of Init and an error aborts the start
+type contextOpener interface {
+	Open() error
+}
+
+func openContext(serverContext ServerContext) error {
+	if opener, ok := serverContext.(contextOpener); ok {
+		return opener.Open()
+	}
+	serverContext.Init()
+	return nil
+}
+
+//release what a context holds when the server stops , for contexts implementing io.Closer such as
+//DefaultServerContext which closes its db pools
+func closeContext(serverContext ServerContext) error {
+	if closer, ok := serverContext.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
 type DefaultServerContext struct {
-	defaultDb  bdb.BufferedDB
-	dbs        map[string]bdb.BufferedDB
-	template   *template.Template
-	properties map[string]string
-	config     *ServerConfig
+	defaultDb       bdb.BufferedDB
+	dbs             map[string]bdb.BufferedDB
+	template        *template.Template
+	properties      map[string]string
+	config          *ServerConfig
+	sqlDbs          []*sql.DB
+	lock            sync.RWMutex
+	changeListeners []func(ConfigChange)
+	secrets         *secretResolver
+	loadErr         error
 }
 
 func (defaultContext *DefaultServerContext) GetDb() bdb.BufferedDB {
@@ -48,32 +146,102 @@ func (defaultContext *DefaultServerContext) GetSelectDb(dbName string) bdb.Buffe
 }
 
 func (defaultContext *DefaultServerContext) GetProperty(key string) string {
+	defaultContext.lock.RLock()
+	defer defaultContext.lock.RUnlock()
 	return defaultContext.properties[key]
 }
 
 func (defaultContext *DefaultServerContext) ContainsProperty(key string) bool {
+	defaultContext.lock.RLock()
+	defer defaultContext.lock.RUnlock()
 	_, ok := defaultContext.properties[key]
 	return ok
 }
 
+func (defaultContext *DefaultServerContext) GetInt(key string, def int) int {
+	return propertyInt(defaultContext, key, def)
+}
+
+func (defaultContext *DefaultServerContext) GetBool(key string, def bool) bool {
+	return propertyBool(defaultContext, key, def)
+}
+
+func (defaultContext *DefaultServerContext) GetDuration(key string, def time.Duration) time.Duration {
+	return propertyDuration(defaultContext, key, def)
+}
+
+func (defaultContext *DefaultServerContext) GetStringSlice(key string, def []string) []string {
+	return propertyStringSlice(defaultContext, key, def)
+}
+
+func (defaultContext *DefaultServerContext) BindProperties(prefix string, target interface{}) error {
+	return bindProperties(defaultContext, prefix, target)
+}
+
+func (defaultContext *DefaultServerContext) GetProfile() string {
+	return activeProfile(defaultContext.config)
+}
+
 func (defaultContext *DefaultServerContext) ExecuteTemplate(wr io.Writer, name string, data interface{}) error {
-	return defaultContext.template.ExecuteTemplate(wr, name, data)
+	defaultContext.lock.RLock()
+	temp := defaultContext.template
+	defaultContext.lock.RUnlock()
+	return temp.ExecuteTemplate(wr, name, data)
+}
+
+func (defaultContext *DefaultServerContext) AddChangeListener(listener func(ConfigChange)) {
+	defaultContext.lock.Lock()
+	defer defaultContext.lock.Unlock()
+	defaultContext.changeListeners = append(defaultContext.changeListeners, listener)
 }
 
+//init for callers of the ServerContext interface , exits the process on errors , see Open
 func (defaultContext *DefaultServerContext) Init() {
-	temp := template.New("default")
-	for _, templateConfig := range defaultContext.config.Templates {
-		dir := templateConfig.Dir
-		temp.ParseGlob(dir + "/*")
+	if err := defaultContext.Open(); err != nil {
+		Fatal(err)
+	}
+}
+
+//load the properties , templates and secrets and open the dbs
+func (defaultContext *DefaultServerContext) Open() error {
+	if defaultContext.loadErr != nil {
+		//the files may have been fixed since the context was created
+		properties, err := loadProperties(defaultContext.config.PropertiesConfig)
+		if err != nil {
+			return err
+		}
+		defaultContext.lock.Lock()
+		//only properties set at runtime are kept in the map of a failed load
+		for key, value := range defaultContext.properties {
+			properties[key] = value
+		}
+		defaultContext.properties = properties
+		defaultContext.loadErr = nil
+		defaultContext.lock.Unlock()
+	}
+	temp, err := loadTemplates(defaultContext.config.Templates)
+	if err != nil {
+		return err
+	}
+	defaultContext.lock.Lock()
+	err = defaultContext.secrets.resolveProperties(defaultContext.properties)
+	defaultContext.lock.Unlock()
+	if err != nil {
+		return err
 	}
 	dbs := map[string]bdb.BufferedDB{}
 	var defaultDb bdb.BufferedDB = nil
 	for _, dbConfig := range defaultContext.config.Databases {
+		//resolved on the copy , the config keeps the references
+		if err := defaultContext.resolveCredentials(&dbConfig); err != nil {
+			return err
+		}
 		db, err := sql.Open(dbConfig.DriverName, dbConfig.GenerateUrl())
 		if err != nil {
-			Fatal("db {} connection failed ", dbConfig.DbName, err)
+			return errors.New("db " + dbConfig.DbName + " connection failed: " + err.Error())
 		}
 		db.SetMaxOpenConns(dbConfig.MaxConnections)
+		defaultContext.sqlDbs = append(defaultContext.sqlDbs, db)
 		bufferedDb := bdb.NewBufferedDb(db)
 		dbs[dbConfig.DbName] = bufferedDb
 		if dbConfig.IsDefault {
@@ -83,74 +251,144 @@ func (defaultContext *DefaultServerContext) Init() {
 			defaultDb = bufferedDb
 		}
 	}
+	defaultContext.lock.Lock()
 	defaultContext.defaultDb = defaultDb
 	defaultContext.dbs = dbs
 	defaultContext.template = temp
+	defaultContext.lock.Unlock()
+	return nil
+}
+
+func (defaultContext *DefaultServerContext) resolveCredentials(dbConfig *Database) (err error) {
+	if dbConfig.Username, err = defaultContext.secrets.resolveCredential(dbConfig.Username); err != nil {
+		return errors.New("db " + dbConfig.Name + " username: " + err.Error())
+	}
+	if dbConfig.Password, err = defaultContext.secrets.resolveCredential(dbConfig.Password); err != nil {
+		return errors.New("db " + dbConfig.Name + " password: " + err.Error())
+	}
+	return nil
 }
 
+//what Open loads and resolves , without opening the databases nor changing the context
+func (defaultContext *DefaultServerContext) check() error {
+	if defaultContext.loadErr != nil {
+		return defaultContext.loadErr
+	}
+	if _, err := loadTemplates(defaultContext.config.Templates); err != nil {
+		return err
+	}
+	defaultContext.lock.RLock()
+	properties := make(map[string]string, len(defaultContext.properties))
+	for key, value := range defaultContext.properties {
+		properties[key] = value
+	}
+	defaultContext.lock.RUnlock()
+	if err := defaultContext.secrets.resolveProperties(properties); err != nil {
+		return err
+	}
+	for _, dbConfig := range defaultContext.config.Databases {
+		if err := defaultContext.resolveCredentials(&dbConfig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (defaultContext *DefaultServerContext) Close() error {
+	var err error
+	for _, db := range defaultContext.sqlDbs {
+		if e := db.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	defaultContext.sqlDbs = nil
+	return err
+}
+
+//properties which can not be loaded are reported by Open
 func NewContextFrom(config *ServerConfig) *DefaultServerContext {
+	properties, err := loadProperties(config.PropertiesConfig)
+	if err != nil {
+		Debug(err)
+		properties = map[string]string{}
+	}
+	return &DefaultServerContext{properties: properties, config: config, secrets: newSecretResolver(), loadErr: err}
+}
 
+//read the inline properties and every properties file , later files win
+func loadProperties(config PropertiesConfig) (map[string]string, error) {
 	properties := map[string]string{}
-	for key, value := range config.PropertiesConfig.Properties {
+	for key, value := range config.Properties {
 		properties[key] = value
-		DebugF("SystemProperties:'%s'='%s'", key, value)
+		DebugF("SystemProperties:'%s'='%s'", key, loggedProperty(key, value))
 	}
-	for _, pf := range config.PropertiesConfig.PropertiesFiles {
+	for _, pf := range config.PropertiesFiles {
 		locate := pf.Locate
-		tmp, err := os.Open(locate)
-		if err != nil {
-			Fatal(err)
-		}
-		stat, err := tmp.Stat()
+		stat, err := os.Stat(locate)
 		if err != nil {
-			Fatal(err)
+			return nil, err
 		}
 		if stat.IsDir() {
 			files, err := ioutil.ReadDir(pf.Locate)
 			if err != nil {
-				Fatal(err)
+				return nil, err
 			}
 
 			for _, file := range files {
 				name := file.Name()
-				if strings.HasSuffix(strings.ToUpper(name), ".PROPERTIES") {
-					parsePropertiesFile(locate+name, properties)
+				if !file.IsDir() && strings.HasSuffix(strings.ToUpper(name), ".PROPERTIES") {
+					if err := parsePropertiesFile(filepath.Join(locate, name), properties); err != nil {
+						return nil, err
+					}
 				}
 			}
-		} else {
-			properties = parsePropertiesFile(locate, properties)
+		} else if err := parsePropertiesFile(locate, properties); err != nil {
+			return nil, err
 		}
 	}
+	return properties, nil
+}
 
-	return &DefaultServerContext{properties: properties, config: config}
+//parse the files of every template dir into one set
+func loadTemplates(templates []Template) (*template.Template, error) {
+	temp := template.New("default").Funcs(csrfTemplateFuncs)
+	for _, templateConfig := range templates {
+		matches, err := filepath.Glob(filepath.Join(templateConfig.Dir, "*"))
+		if err != nil {
+			return nil, err
+		}
+		var files []string
+		for _, match := range matches {
+			if stat, err := os.Stat(match); err == nil && !stat.IsDir() {
+				files = append(files, match)
+			}
+		}
+		if len(files) == 0 {
+			continue
+		}
+		if _, err := temp.ParseFiles(files...); err != nil {
+			return nil, err
+		}
+	}
+	return temp, nil
 }
 
-func parsePropertiesFile(locate string, properties map[string]string) map[string]string {
+func parsePropertiesFile(locate string, properties map[string]string) error {
 	Debug("loading file:" + locate)
 	content, err := ioutil.ReadFile(locate)
 	if err != nil {
-		Fatal(err)
+		return err
 	}
-	lines := strings.Split(string(content), "\n")
-	for i, line := range lines {
-		if len(strings.Trim(line, "")) == 0 {
-			continue
-		}
-		if line[0:1] == "#" {
-			continue
-		}
-		sepIndex := strings.Index(line, "=")
-		if sepIndex == -1 {
-			DebugF("properties file parse failed :[%s]:%d:%s\n", locate, i, line)
-		} else {
-			value := line[sepIndex+1:]
-			key := line[0:sepIndex]
-			if old, ok := properties[key]; ok {
-				DebugF("duplicate properties found [%s]{'%s'->'%s'} :[%s]:%d:%s\n", key, old, value, locate, i, line)
-			}
-			DebugF("SystemProperties:'%s'='%s'", key, value)
-			properties[key] = value
+	parsed, err := parseProperties(locate, string(content))
+	if err != nil {
+		return err
+	}
+	for _, p := range parsed {
+		if old, ok := properties[p.key]; ok && old != p.value {
+			DebugF("duplicate properties found [%s]{'%s'->'%s'} :[%s]:%d", p.key, loggedProperty(p.key, old), loggedProperty(p.key, p.value), locate, p.line)
 		}
+		DebugF("SystemProperties:'%s'='%s'", p.key, loggedProperty(p.key, p.value))
+		properties[p.key] = p.value
 	}
-	return properties
+	return nil
 }
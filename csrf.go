@@ -0,0 +1,134 @@
+package wserver
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"github.com/fitmewell/wserver/wsession"
+	"html/template"
+	"net/http"
+	"sync"
+)
+
+//key of the csrf token in ServletContext data , templates may also use {{csrfToken .}} or {{csrfField .}}
+const CSRFTokenKey = "CSRFToken"
+
+const (
+	csrfSessionKey    = "wserver.csrf"
+	csrfFieldNameKey  = "wserver.csrfField"
+	defaultCsrfField  = "csrf_token"
+	defaultCsrfHeader = "X-CSRF-Token"
+)
+
+type csrfGuard struct {
+	fieldName  string
+	headerName string
+	//parallel requests of a new session must agree on one token
+	lock sync.Mutex
+}
+
+func newCsrfAspect(config Csrf) AspectHandler {
+	guard := &csrfGuard{fieldName: config.FieldName, headerName: config.HeaderName}
+	if guard.fieldName == "" {
+		guard.fieldName = defaultCsrfField
+	}
+	if guard.headerName == "" {
+		guard.headerName = defaultCsrfHeader
+	}
+	excludes := make([]string, 0, len(config.ExcludePaths))
+	for _, path := range config.ExcludePaths {
+		excludes = append(excludes, trimPathWildcard(path))
+	}
+	return &DefaultAspectHandler{
+		Execute: guard.serve,
+		CustomCheck: func(req *http.Request) bool {
+			for _, exclude := range excludes {
+				if pathUnder(req.URL.Path, exclude) {
+					return false
+				}
+			}
+			return true
+		},
+		PositionFlg: true,
+	}
+}
+
+//token of session , created on first use
+func (g *csrfGuard) sessionToken(session wsession.Session) (string, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if token, _ := session.Get(csrfSessionKey).(string); token != "" {
+		return token, nil
+	}
+	token, err := newCsrfToken()
+	if err != nil {
+		return "", err
+	}
+	session.Set(csrfSessionKey, token)
+	return token, nil
+}
+
+func (g *csrfGuard) serve(context ServletContext, resp http.ResponseWriter, req *http.Request) bool {
+	session := context.GetSession()
+	if session == nil {
+		return true
+	}
+	token, err := g.sessionToken(session)
+	if err != nil {
+		http.Error(resp, STATUS_INTERNAL_SERVER_ERROR.statusMessage, STATUS_INTERNAL_SERVER_ERROR.statusCode)
+		return false
+	}
+	context.SetData(CSRFTokenKey, token)
+	context.SetData(csrfFieldNameKey, g.fieldName)
+
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	sent := req.Header.Get(g.headerName)
+	if sent == "" {
+		sent = req.FormValue(g.fieldName)
+	}
+	if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+		http.Error(resp, STATUS_FORBIDDEN.statusMessage, STATUS_FORBIDDEN.statusCode)
+		return false
+	}
+	return true
+}
+
+//url safe so the token can be sent in forms , headers and query strings as it is
+func newCsrfToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+//template functions reading the token from the servlet data , use {{csrfField .}} inside a form
+var csrfTemplateFuncs = template.FuncMap{
+	"csrfToken": func(data interface{}) string {
+		token, _ := csrfFromData(data)
+		return token
+	},
+	"csrfField": func(data interface{}) template.HTML {
+		token, field := csrfFromData(data)
+		if token == "" {
+			return ""
+		}
+		return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(field) + `" value="` + template.HTMLEscapeString(token) + `">`)
+	},
+}
+
+func csrfFromData(data interface{}) (token string, field string) {
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		return "", ""
+	}
+	token, _ = m[CSRFTokenKey].(string)
+	field, _ = m[csrfFieldNameKey].(string)
+	if field == "" {
+		field = defaultCsrfField
+	}
+	return token, field
+}
@@ -0,0 +1,103 @@
+package wserver
+
+import (
+	"github.com/fitmewell/wserver/wsession"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCsrf(t *testing.T) {
+	s := NewServer(&ServerConfig{Session: Session{CookieName: "sid"}, Csrf: Csrf{Enable: true}})
+	s.AddHandler("GET", "/form", func(c ServletContext) []byte {
+		token, _ := c.GetData()[CSRFTokenKey].(string)
+		return []byte(token)
+	})
+	s.AddHandler("POST", "/form", func() []byte { return []byte("saved") })
+	s.AddHandler("POST", "/webhook/github", func() []byte { return []byte("hooked") })
+	s.AddHandler("POST", "/webhooks", func() []byte { return []byte("hooked") })
+	s.ExcludeCsrf("/webhook/**")
+	initTestHandler(t, s)
+
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, httptest.NewRequest("GET", "/form", nil))
+	token := rec.Body.String()
+	cookies := rec.Result().Cookies()
+	if token == "" || len(cookies) == 0 {
+		t.Fatalf("expected a token and a session cookie, got %q %v", token, cookies)
+	}
+	if strings.ContainsAny(token, "+/=") {
+		t.Errorf("token should be url safe: %q", token)
+	}
+	post := func(path string, body string, header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookies[0])
+		if header != "" {
+			req.Header.Set(defaultCsrfHeader, header)
+		}
+		rec := httptest.NewRecorder()
+		s.handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := post("/form", "", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("missing token should be rejected, got %d", rec.Code)
+	}
+	if rec := post("/form", "", "forged"); rec.Code != http.StatusForbidden {
+		t.Errorf("wrong token should be rejected, got %d", rec.Code)
+	}
+	if rec := post("/form", "", token); rec.Code != http.StatusOK || rec.Body.String() != "saved" {
+		t.Errorf("token in header should pass, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := post("/form", defaultCsrfField+"="+url.QueryEscape(token), ""); rec.Code != http.StatusOK {
+		t.Errorf("token in form should pass, got %d", rec.Code)
+	}
+	if rec := post("/webhook/github", "", ""); rec.Code != http.StatusOK || rec.Body.String() != "hooked" {
+		t.Errorf("excluded path should skip the check, got %d", rec.Code)
+	}
+	if rec := post("/webhooks", "", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("path sharing only a prefix with an excluded path should be checked, got %d", rec.Code)
+	}
+}
+
+func TestCsrfTemplateFuncs(t *testing.T) {
+	data := map[string]interface{}{CSRFTokenKey: `a"b`, csrfFieldNameKey: "token"}
+	field := csrfTemplateFuncs["csrfField"].(func(interface{}) template.HTML)(data)
+	if string(field) != `<input type="hidden" name="token" value="a&#34;b">` {
+		t.Errorf("unexpected field %s", field)
+	}
+	if field := csrfTemplateFuncs["csrfField"].(func(interface{}) template.HTML)(nil); field != "" {
+		t.Errorf("no token should render nothing, got %s", field)
+	}
+}
+
+func TestCsrfTokenParallelRequests(t *testing.T) {
+	session := wsession.NewDefaultSessionManager("").NewSession()
+	guard := &csrfGuard{}
+	tokens := make(chan string, 20)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(tokens); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := guard.sessionToken(session)
+			if err != nil {
+				t.Error(err)
+			}
+			tokens <- token
+		}()
+	}
+	wg.Wait()
+	close(tokens)
+	first := <-tokens
+	for token := range tokens {
+		if token != first {
+			t.Fatalf("parallel requests of one session got different tokens %q %q", first, token)
+		}
+	}
+}
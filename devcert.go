@@ -0,0 +1,172 @@
+package wserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	. "github.com/fitmewell/wserver/log"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	devCAName    = "wserver-dev-ca"
+	devCAValid   = 10 * 365 * 24 * time.Hour
+	devLeafName  = "localhost"
+	devLeafValid = 365 * 24 * time.Hour
+	//renew the leaf certificate this long before it expires
+	devLeafRenew = 30 * 24 * time.Hour
+)
+
+//where the instructions to trust a new development CA go , whatever the log level
+var devCertOutput io.Writer = os.Stderr
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+//certificate pair signed by a cached local CA for localhost and DevCertificate.Hosts ,
+//created on first use and renewed when hosts change or it is about to expire
+func (ws *Server) devCertificate() (certFile string, keyFile string, err error) {
+	config := ws.config.SSLConfig.DevCertificate
+	if profile, ok := productionProfile(ws.config); ok {
+		return "", "", errors.New("development certificates are refused in profile " + profile)
+	}
+	dir := config.Dir
+	if dir == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			return "", "", err
+		}
+		dir = filepath.Join(cache, "wserver", "devcert")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", err
+	}
+	hosts := append([]string{"localhost", "127.0.0.1", "::1"}, config.Hosts...)
+
+	caFile, caKeyFile := filepath.Join(dir, devCAName+".crt"), filepath.Join(dir, devCAName+".key")
+	ca, caKey, err := loadKeyPair(caFile, caKeyFile)
+	if err != nil {
+		Debug("creating development CA in ", dir)
+		template := &x509.Certificate{
+			Subject:               pkix.Name{CommonName: "wserver development CA", Organization: []string{"wserver"}},
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		}
+		if ca, caKey, err = createCertificate(template, devCAValid, nil, nil, caFile, caKeyFile); err != nil {
+			return "", "", err
+		}
+		printTrustInstructions(caFile)
+	}
+
+	certFile, keyFile = filepath.Join(dir, devLeafName+".crt"), filepath.Join(dir, devLeafName+".key")
+	if leaf, _, err := loadKeyPair(certFile, keyFile); err == nil && devLeafUsable(leaf, ca, hosts) {
+		return certFile, keyFile, nil
+	}
+	Debug("creating development certificate for ", hosts)
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: hosts[0], Organization: []string{"wserver development"}},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	if _, _, err := createCertificate(template, devLeafValid, ca, caKey, certFile, keyFile); err != nil {
+		return "", "", err
+	}
+	return certFile, keyFile, nil
+}
+
+//leaf signed by ca , valid for a while and covering every host
+func devLeafUsable(leaf *x509.Certificate, ca *x509.Certificate, hosts []string) bool {
+	if leaf.CheckSignatureFrom(ca) != nil || time.Now().Add(devLeafRenew).After(leaf.NotAfter) {
+		return false
+	}
+	for _, host := range hosts {
+		if leaf.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func loadKeyPair(certFile, keyFile string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, nil, errors.New("unexpected key type in " + keyFile)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+//sign template with parent , self signed when parent is nil , and write the pem files
+func createCertificate(template *x509.Certificate, valid time.Duration, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, certFile, keyFile string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(valid)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		return nil, nil, err
+	}
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+func printTrustInstructions(caFile string) {
+	fmt.Fprintf(devCertOutput, `trust the development CA %[1]s to avoid browser warnings:
+  linux:   sudo cp %[1]s /usr/local/share/ca-certificates/%[2]s.crt && sudo update-ca-certificates
+  macos:   sudo security add-trusted-cert -d -r trustRoot -k /Library/Keychains/System.keychain %[1]s
+  windows: certutil -addstore -f ROOT %[1]s
+  firefox uses its own store: Settings > Privacy & Security > Certificates > Import
+`, caFile, devCAName)
+}
@@ -0,0 +1,58 @@
+package wserver
+
+import (
+	wlog "github.com/fitmewell/wserver/log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDevCertificate(t *testing.T) {
+	var printed strings.Builder
+	devCertOutput = &printed
+	defer func() { devCertOutput = os.Stderr }()
+	t.Setenv(profileEnv, "")
+	wlog.SetDebug(false)
+	defer wlog.SetDebug(true)
+	dir := t.TempDir()
+	s := NewServer(&ServerConfig{SSLConfig: SSLConfig{DevCertificate: DevCertificate{Enable: true, Dir: dir, Hosts: []string{"app.test"}}}})
+	certFile, keyFile, err := s.devCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _, err := loadKeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _, err := loadKeyPair(filepath.Join(dir, devCAName+".crt"), filepath.Join(dir, devCAName+".key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !devLeafUsable(leaf, ca, []string{"localhost", "127.0.0.1", "::1", "app.test"}) {
+		t.Error("leaf should be signed by the CA for localhost and the hosts")
+	}
+	if !strings.Contains(printed.String(), "trust the development CA") {
+		t.Errorf("trust instructions should be printed with the debug log off, got %q", printed.String())
+	}
+
+	printed.Reset()
+	if _, _, err := s.devCertificate(); err != nil || printed.Len() != 0 {
+		t.Errorf("cached CA should be reused silently, got %v %q", err, printed.String())
+	}
+	reused, _, _ := loadKeyPair(certFile, keyFile)
+	if !reused.Equal(leaf) {
+		t.Error("usable leaf should be reused")
+	}
+	s.config.SSLConfig.DevCertificate.Hosts = []string{"other.test"}
+	s.devCertificate()
+	if renewed, _, _ := loadKeyPair(certFile, keyFile); renewed.Equal(leaf) || renewed.VerifyHostname("other.test") != nil {
+		t.Error("leaf should be renewed when the hosts change")
+	}
+
+	t.Setenv(profileEnv, "prod")
+	s.config.Profile = "dev"
+	if _, _, err := s.devCertificate(); err == nil {
+		t.Error("development certificates should be refused when WSERVER_PROFILE is prod")
+	}
+}
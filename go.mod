@@ -0,0 +1,11 @@
+module github.com/fitmewell/wserver
+
+go 1.24
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/go-sql-driver/mysql v1.9.3
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require filippo.io/edwards25519 v1.1.0 // indirect
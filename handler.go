@@ -1,46 +1,100 @@
 package wserver
 
 import (
+	"context"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	. "github.com/fitmewell/wserver/log"
 	"io/ioutil"
 	"net/http"
 	"reflect"
 	"strings"
+	"time"
 )
 
 type wHandler struct {
 	wServer     *Server
 	handlerTree handlerTree
+	timeouts    *timeoutTable
+	cache       *responseCache
+	proxies     *proxyResolver
+	maintenance *maintenanceMode
+	static      *staticResources
+	//init is done once , a retried Start keeps the aspects and handlers added by the first one
+	initialized bool
 }
 
 func newDefaultHandler(wServer *Server) (h *wHandler) {
-	h = &wHandler{wServer: wServer, handlerTree: newDefaultHandlerTree()}
+	h = &wHandler{wServer: wServer, handlerTree: newDefaultHandlerTree(), maintenance: newMaintenanceMode(wServer.config.Maintenance),
+		static: &staticResources{}}
 	return
 }
 
-func (h *wHandler) init() {
-	for _, resource := range h.wServer.config.StaticResources {
-		path := resource.Path
-		if strings.HasSuffix(path, "**") {
-			path = path[0 : len(path)-2]
+func (h *wHandler) init() error {
+	if h.initialized {
+		return nil
+	}
+	timeouts, err := newTimeoutTable(h.wServer.config.Timeout)
+	if err != nil {
+		return errors.New("timeout config parse failed: " + err.Error())
+	}
+	h.timeouts = timeouts
+	cache, err := newResponseCache(h.wServer.config.ResponseCache)
+	if err != nil {
+		return errors.New("response cache config parse failed: " + err.Error())
+	}
+	h.cache = cache
+	proxies, err := newProxyResolver(h.wServer.config.TrustedProxies)
+	if err != nil {
+		return errors.New("trusted proxies config parse failed: " + err.Error())
+	}
+	h.proxies = proxies
+	maintenance := h.wServer.config.Maintenance
+	if h.wServer.config.Health.Enable {
+		if err := h.addHealthHandlers(); err != nil {
+			return errors.New("health config parse failed: " + err.Error())
 		}
-		if strings.HasSuffix(path, "*") {
-			path = path[0 : len(path)-1]
+		liveness, health, readiness := h.healthPaths()
+		maintenance.ExcludePaths = append(append([]string(nil), maintenance.ExcludePaths...), liveness, health, readiness)
+	}
+	if err := h.maintenance.configure(maintenance); err != nil {
+		return errors.New("maintenance config parse failed: " + err.Error())
+	}
+	if rules := h.wServer.config.AccessRules; len(rules) != 0 {
+		aspect, err := newAccessAspect(rules)
+		if err != nil {
+			return errors.New("access rules config parse failed: " + err.Error())
 		}
-		t := http.StripPrefix(path, http.FileServer(http.Dir(resource.FileLocate)))
-		DebugF("Severing static files: %s %s", path, resource.FileLocate)
-		h.addHandler("GET", resource.Path, func(context ServletContext, resp http.ResponseWriter, req *http.Request) error {
-			t.ServeHTTP(resp, req)
-			return nil
-		})
+		h.addAspect(aspect)
+	}
+	if config := h.wServer.config.SecurityHeaders; config.Enable {
+		h.addAspect(newSecurityHeaderAspect(config))
+	}
+	if config := h.wServer.config.Csrf; config.Enable {
+		h.addAspect(newCsrfAspect(config))
 	}
+	h.setStaticResources(h.wServer.config.StaticResources)
+	h.initialized = true
+	return nil
 }
 
 func (h *wHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	handle := h.handle
+	if timeout := h.timeouts.get(strings.Split(req.RequestURI, "?")[0]); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+		handle = h.handleWithin
+	}
 	tmp_session := h.wServer.sessionManager.Sync(resp, req)
-	servletContext := &DefaultServletContext{ServerContext: h.wServer.context, Session: tmp_session, data: map[string]interface{}{}}
+	servletContext := &DefaultServletContext{ServerContext: h.wServer.context, Session: tmp_session, data: map[string]interface{}{}, ctx: ctx,
+		clientIP: h.proxies.clientIP(req), scheme: h.proxies.scheme(req), host: h.proxies.host(req)}
+	if h.maintenance.serve(servletContext, resp, req) {
+		return
+	}
 	if !h.handlerTree.AspectBefore(servletContext, resp, req) {
 		return
 	}
@@ -48,19 +102,21 @@ func (h *wHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 	Debug("METHOD:" + req.Method + "\tPATH:" + req.RequestURI)
 	if ha := h.handlerTree.GetHandler(req); ha != nil {
 		//err = ha(servletContext, resp, req)
-		err = h.handle(servletContext, resp, req, ha)
-		if err != nil {
-			if e, ok := err.(*StatusError); ok {
-				switch e.statusCode {
-				case STATUS_UNAUTHORIZED.statusCode:
-					http.Redirect(resp, req, "/", STATUS_UNAUTHORIZED.statusCode)
-				default:
-					http.Error(resp, e.statusMessage, e.statusCode)
-				}
+		if route := h.cache.route(req); route == nil {
+			err = handle(servletContext, resp, req, ha)
+			if err != nil {
+				h.handleError(resp, req, err)
+			}
+		} else if !h.cache.serve(route, resp, req) {
+			rec := newCacheRecorder(resp, h.cache.maxEntryBytes)
+			err = handle(servletContext, rec, req, ha)
+			if err != nil {
+				h.handleError(rec, req, err)
 			} else {
-				Debug(err)
+				token, _ := servletContext.GetData()[CSRFTokenKey].(string)
+				nonce, _ := servletContext.GetData()[CSPNonceKey].(string)
+				h.cache.store(route, req, rec, token, nonce)
 			}
-			//wServer.handlerTree.HandlerError TODO  add common error handler here
 		}
 	} else {
 		accept := req.Header.Get("Accept")
@@ -75,6 +131,66 @@ func (h *wHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 	}
 }
 
+func (h *wHandler) handleError(resp http.ResponseWriter, req *http.Request, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = STATUS_GATEWAY_TIMEOUT
+	} else if errors.Is(err, context.Canceled) {
+		//the client went away , nobody reads an answer
+		Debug("request cancelled: " + req.RequestURI)
+		return
+	} else if errors.Is(err, errResponseStarted) {
+		Debug(err.Error() + ": " + req.RequestURI)
+		return
+	}
+	if e, ok := err.(*StatusError); ok {
+		switch e.statusCode {
+		case STATUS_UNAUTHORIZED.statusCode:
+			http.Redirect(resp, req, "/", STATUS_UNAUTHORIZED.statusCode)
+		default:
+			http.Error(resp, e.statusMessage, e.statusCode)
+		}
+	} else {
+		Debug(err)
+	}
+	//wServer.handlerTree.HandlerError TODO  add common error handler here
+}
+
+//run handle against a buffer and answer 504 when the deadline of the request context expires first ,
+//the handler keeps running on its own copy of the servlet context and its late writes are dropped
+func (h *wHandler) handleWithin(context ServletContext, resp http.ResponseWriter, req *http.Request, m interface{}) error {
+	tw := newTimeoutWriter(resp)
+	handlerContext := context
+	servletContext, detached := context.(*DefaultServletContext)
+	if detached {
+		handlerContext = servletContext.detach()
+	}
+	done := make(chan error, 1)
+	panicked := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				panicked <- p
+			}
+		}()
+		done <- h.handle(handlerContext, tw, req, m)
+	}()
+	select {
+	case err := <-done:
+		tw.finish()
+		if detached {
+			servletContext.adopt(handlerContext.(*DefaultServletContext))
+		}
+		return err
+	case p := <-panicked:
+		panic(p)
+	case <-req.Context().Done():
+		if !tw.timeout() {
+			return errResponseStarted
+		}
+		return req.Context().Err()
+	}
+}
+
 func (h *wHandler) addHandler(method string, path string, e interface{}) *wHandler {
 	h.handlerTree.AddHandler(method, path, e)
 	return h
@@ -201,6 +317,10 @@ func (h *wHandler) handle(context ServletContext, resp http.ResponseWriter, req
 			}
 			//todo
 		case reflect.Struct:
+			if c, ok := out.Interface().(Conditional); ok {
+				h.writeConditional(resp, req, c)
+				continue
+			}
 			resp.Header().Set("Content-Type", "application/json")
 			tb, err := json.Marshal(out.Interface())
 			if err != nil {
@@ -208,11 +328,11 @@ func (h *wHandler) handle(context ServletContext, resp http.ResponseWriter, req
 				resp.Write([]byte(err.Error()))
 				break
 			}
-			resp.Write(tb)
+			h.writeBody(resp, req, tb, "", time.Time{})
 		case reflect.Slice:
 			switch out.Type().Elem().Kind() {
 			case reflect.Uint8:
-				resp.Write(out.Interface().([]byte))
+				h.writeBody(resp, req, out.Interface().([]byte), "", time.Time{})
 			default:
 				tb, err := json.Marshal(out.Interface())
 				if err != nil {
@@ -220,7 +340,7 @@ func (h *wHandler) handle(context ServletContext, resp http.ResponseWriter, req
 					resp.Write([]byte(err.Error()))
 					break
 				}
-				resp.Write(tb)
+				h.writeBody(resp, req, tb, "", time.Time{})
 			}
 		}
 	}
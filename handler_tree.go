@@ -2,6 +2,7 @@ package wserver
 
 import (
 	"net/http"
+	"sync"
 )
 
 type handlerTree interface {
@@ -10,6 +11,7 @@ type handlerTree interface {
 	GetHandler(*http.Request) interface{}
 	AspectBefore(ServletContext, http.ResponseWriter, *http.Request) bool
 	AspectAfter(ServletContext, http.ResponseWriter, *http.Request) bool
+	Walk(visit func(method string, path string, handler interface{}))
 }
 
 func newDefaultHandlerTree() handlerTree {
@@ -22,9 +24,13 @@ type defaultHandlerTree struct {
 	rootNode             handlerTreeNode
 	beforeAspectHandlers []AspectHandler
 	afterAspectHandlers  []AspectHandler
+	//handlers may be added while serving , such as static resources of a reloaded config
+	lock sync.RWMutex
 }
 
 func (h *defaultHandlerTree) AddHandler(method string, path string, handler interface{}) handlerTree {
+	h.lock.Lock()
+	defer h.lock.Unlock()
 	h.rootNode.addHandler(method, path, handler)
 	return h
 }
@@ -37,12 +43,19 @@ func (h *defaultHandlerTree) AddAspect(handler AspectHandler) handlerTree {
 	return h
 }
 func (h *defaultHandlerTree) GetHandler(req *http.Request) interface{} {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
 	node := h.rootNode.getChild(req.RequestURI)
 	if node == nil {
 		return nil
 	}
 	return node.getHandler(req)
 }
+func (h *defaultHandlerTree) Walk(visit func(method string, path string, handler interface{})) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	h.rootNode.walk(visit)
+}
 func (h *defaultHandlerTree) AspectBefore(serverContext ServletContext, resp http.ResponseWriter, req *http.Request) bool {
 	for _, aspect := range h.beforeAspectHandlers {
 		if aspect.ShouldAppendOn(req) {
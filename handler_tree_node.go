@@ -3,6 +3,7 @@ package wserver
 import (
 	"errors"
 	"net/http"
+	"sort"
 	"strings"
 )
 
@@ -13,6 +14,7 @@ type handlerTreeNode interface {
 	addChild(handler handlerTreeNode) (handlerTreeNode, error)
 	addHandler(method string, path string, handler interface{}) (handlerTreeNode, error)
 	getHandler(req *http.Request) interface{}
+	walk(visit func(method string, path string, handler interface{}))
 }
 
 type defaultHandlerTreeNode struct {
@@ -61,6 +63,30 @@ func (t *defaultHandlerTreeNode) getHandler(req *http.Request) interface{} {
 	return nil
 }
 
+//visit the handlers of this node and its children , sorted by path and method
+func (t *defaultHandlerTreeNode) walk(visit func(method string, path string, handler interface{})) {
+	methods := make([]string, 0, len(t.handlers))
+	for method := range t.handlers {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	for _, method := range methods {
+		path := t.Path
+		if path == "" {
+			path = "/"
+		}
+		visit(method, path, t.handlers[method])
+	}
+	keys := make([]string, 0, len(t.childNodes))
+	for key := range t.childNodes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		t.childNodes[key].walk(visit)
+	}
+}
+
 func (t *defaultHandlerTreeNode) hasChild(path string) bool {
 	_, ok := t.childNodes[path]
 	return ok
@@ -0,0 +1,171 @@
+package wserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/fitmewell/wserver/bdb"
+	. "github.com/fitmewell/wserver/log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLivenessPath       = "/livez"
+	defaultHealthPath         = "/healthz"
+	defaultReadinessPath      = "/readyz"
+	defaultHealthTimeout      = 5 * time.Second
+	healthStatusOk            = "ok"
+	healthStatusFailed        = "fail"
+	sessionHealthCheck        = "session"
+	servingHealthCheck        = "serving"
+	databaseHealthCheckPrefix = "db:"
+	healthCheckFailed         = "check failed"
+	healthCheckTimeout        = "check timed out"
+)
+
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+type healthResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type healthReport struct {
+	Status string                  `json:"status"`
+	Checks map[string]healthResult `json:"checks,omitempty"`
+}
+
+//implemented by session managers able to check their store
+type sessionPinger interface {
+	Ping() error
+}
+
+//add check run by the health and readiness endpoints , ctx carries Health.Timeout
+func (ws *Server) AddHealthCheck(name string, check func(ctx context.Context) error) *Server {
+	ws.healthChecks = append(ws.healthChecks, healthCheck{name: name, check: check})
+	return ws
+}
+
+func (h *wHandler) healthPaths() (liveness, health, readiness string) {
+	config := h.wServer.config.Health
+	liveness, health, readiness = config.LivenessPath, config.HealthPath, config.ReadinessPath
+	if liveness == "" {
+		liveness = defaultLivenessPath
+	}
+	if health == "" {
+		health = defaultHealthPath
+	}
+	if readiness == "" {
+		readiness = defaultReadinessPath
+	}
+	return
+}
+
+func (h *wHandler) addHealthHandlers() error {
+	timeout := defaultHealthTimeout
+	if value := h.wServer.config.Health.Timeout; value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		timeout = d
+	}
+	liveness, health, readiness := h.healthPaths()
+	h.addHandler("GET", liveness, func(resp http.ResponseWriter) {
+		writeHealthReport(resp, healthReport{Status: healthStatusOk})
+	})
+	h.addHandler("GET", health, func(resp http.ResponseWriter, req *http.Request) {
+		writeHealthReport(resp, h.runHealthChecks(req.Context(), timeout, false))
+	})
+	h.addHandler("GET", readiness, func(resp http.ResponseWriter, req *http.Request) {
+		writeHealthReport(resp, h.runHealthChecks(req.Context(), timeout, true))
+	})
+	return nil
+}
+
+//run every check concurrently , readiness also fails while the server is not serving or shutting down
+func (h *wHandler) runHealthChecks(ctx context.Context, timeout time.Duration, readiness bool) healthReport {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ws := h.wServer
+	checks := []healthCheck{}
+	for _, dbConfig := range ws.config.Databases {
+		dbName := dbConfig.DbName
+		name := dbConfig.Name
+		if name == "" {
+			name = dbName
+		}
+		checks = append(checks, healthCheck{name: databaseHealthCheckPrefix + name, check: func(ctx context.Context) error {
+			db := ws.context.GetSelectDb(dbName)
+			if db == nil {
+				return errors.New("not connected")
+			}
+			contextDb, ok := db.(bdb.ContextDB)
+			if !ok {
+				//nothing to ping
+				return nil
+			}
+			return contextDb.WithContext(ctx).Ping()
+		}})
+	}
+	if pinger, ok := ws.sessionManager.(sessionPinger); ok {
+		checks = append(checks, healthCheck{name: sessionHealthCheck, check: func(context.Context) error {
+			return pinger.Ping()
+		}})
+	}
+	checks = append(checks, ws.healthChecks...)
+
+	report := healthReport{Status: healthStatusOk, Checks: map[string]healthResult{}}
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c healthCheck) {
+			defer wg.Done()
+			done := make(chan error, 1)
+			go func() { done <- c.check(ctx) }()
+			var err error
+			select {
+			case err = <-done:
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+			result := healthResult{Status: healthStatusOk}
+			if err != nil {
+				//driver errors may carry hosts and dsn details , only the log gets them
+				DebugF("health check %s failed: %v", c.name, err)
+				result = healthResult{Status: healthStatusFailed, Error: healthCheckFailed}
+				if errors.Is(err, context.DeadlineExceeded) {
+					result.Error = healthCheckTimeout
+				}
+			}
+			lock.Lock()
+			report.Checks[c.name] = result
+			lock.Unlock()
+		}(c)
+	}
+	wg.Wait()
+	if readiness && !ws.isServing() {
+		report.Checks[servingHealthCheck] = healthResult{Status: healthStatusFailed, Error: "server is not serving"}
+	}
+	for _, result := range report.Checks {
+		if result.Status != healthStatusOk {
+			report.Status = healthStatusFailed
+		}
+	}
+	return report
+}
+
+func writeHealthReport(resp http.ResponseWriter, report healthReport) {
+	resp.Header().Set("Content-Type", "application/json")
+	resp.Header().Set("Cache-Control", "no-store")
+	if report.Status != healthStatusOk {
+		resp.WriteHeader(STATUS_SERVICE_UNAVAILABLE.statusCode)
+	}
+	json.NewEncoder(resp).Encode(report)
+}
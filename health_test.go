@@ -0,0 +1,125 @@
+package wserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/fitmewell/wserver/bdb"
+	"github.com/fitmewell/wserver/wsession"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	s := NewServer(&ServerConfig{Health: Health{Enable: true}})
+	s.AddHealthCheck("queue", func(context.Context) error {
+		return errors.New("dial tcp queue.internal:5672: connection refused")
+	})
+	initTestHandler(t, s)
+	get := func(path string) (int, healthReport, string) {
+		rec := httptest.NewRecorder()
+		s.handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		var report healthReport
+		json.Unmarshal(rec.Body.Bytes(), &report)
+		return rec.Code, report, rec.Body.String()
+	}
+
+	if code, report, _ := get("/livez"); code != http.StatusOK || report.Status != healthStatusOk {
+		t.Errorf("liveness should pass, got %d %+v", code, report)
+	}
+	code, report, body := get("/healthz")
+	if code != http.StatusServiceUnavailable || report.Checks["queue"].Error != healthCheckFailed {
+		t.Errorf("failing check should fail the health, got %d %s", code, body)
+	}
+	if strings.Contains(body, "queue.internal") {
+		t.Errorf("check errors should not be exposed: %s", body)
+	}
+	if _, report, _ := get("/readyz"); report.Checks[servingHealthCheck].Status != healthStatusFailed {
+		t.Errorf("readiness should fail before the server serves, got %+v", report)
+	}
+	if report.Checks[sessionHealthCheck].Status != healthStatusOk {
+		t.Errorf("session store round trip should pass, got %+v", report.Checks[sessionHealthCheck])
+	}
+	s.sessionManager = brokenSessionStore{s.sessionManager}
+	if _, report, _ := get("/healthz"); report.Checks[sessionHealthCheck].Status != healthStatusFailed {
+		t.Errorf("failing session store should fail the health, got %+v", report.Checks[sessionHealthCheck])
+	}
+}
+
+type brokenSessionStore struct {
+	wsession.SessionManager
+}
+
+func (brokenSessionStore) Ping() error {
+	return errors.New("store unreachable")
+}
+
+//a BufferedDB without the optional bdb.ContextDB methods
+type plainDb struct {
+	bdb.BufferedDB
+}
+
+func TestPlainBufferedDB(t *testing.T) {
+	s := NewServer(&ServerConfig{Health: Health{Enable: true}, Databases: []Database{{DbName: "main"}}})
+	s.context.(*DefaultServerContext).dbs = map[string]bdb.BufferedDB{"main": plainDb{}}
+	initTestHandler(t, s)
+
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	var report healthReport
+	json.Unmarshal(rec.Body.Bytes(), &report)
+	if report.Checks[databaseHealthCheckPrefix+"main"].Status != healthStatusOk {
+		t.Errorf("db without Ping should not fail the health, got %s", rec.Body.String())
+	}
+	servlet := &DefaultServletContext{ServerContext: s.context, ctx: context.Background()}
+	if db := servlet.GetSelectDb("main"); db != (plainDb{}) {
+		t.Errorf("db without WithContext should be returned as it is, got %v", db)
+	}
+}
+
+func TestReadinessDelay(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		configured  string
+		left        time.Duration
+		hasDeadline bool
+		expected    time.Duration
+	}{
+		{"", time.Minute, true, 0},
+		{"soon", time.Minute, true, 0},
+		{"5s", time.Minute, true, 5 * time.Second},
+		{"1m", 0, false, time.Minute},
+		{"1m", 200 * time.Millisecond, true, 100 * time.Millisecond},
+	}
+	for _, c := range cases {
+		if delay := readinessDelay(c.configured, now.Add(c.left), c.hasDeadline, now); delay != c.expected {
+			t.Errorf("%q with %v left: expected %v, got %v", c.configured, c.left, c.expected, delay)
+		}
+	}
+}
+
+func TestReadinessDelayCancelled(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(&ServerConfig{Shutdown: Shutdown{ReadinessDelay: "1h"}}).DisableSignals()
+	go s.Serve(l)
+	<-s.Ready()
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() { stopped <- s.Stop(ctx) }()
+	cancel()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("idle server should drain once the wait is cancelled, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("cancelling the stop context should end the readiness delay")
+	}
+}
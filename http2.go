@@ -0,0 +1,36 @@
+package wserver
+
+import (
+	"net/http"
+	"time"
+)
+
+//set the HTTP2 settings on server , the idle timeout applies to every server , tls servers negotiate http/2 through ALPN and
+//plain servers speak h2c with prior knowledge when HTTP2.H2C is on
+func (ws *Server) configureHTTP2(server *http.Server, useTLS bool) error {
+	config := ws.config.HTTP2
+	if config.IdleTimeout != "" {
+		idle, err := time.ParseDuration(config.IdleTimeout)
+		if err != nil {
+			return err
+		}
+		//closes idle http/1 keep-alive connections as well , so it applies without http/2 too
+		server.IdleTimeout = idle
+	}
+	if !useTLS && !config.H2C {
+		return nil
+	}
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	if useTLS {
+		protocols.SetHTTP2(true)
+	} else {
+		protocols.SetUnencryptedHTTP2(true)
+	}
+	server.Protocols = protocols
+	server.HTTP2 = &http.HTTP2Config{
+		MaxConcurrentStreams: int(config.MaxConcurrentStreams),
+		MaxReadFrameSize:     int(config.MaxReadFrameSize),
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package wserver
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHTTP2(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCertificate(t, dir, "localhost")
+	s := NewServer(&ServerConfig{
+		SSLConfig: SSLConfig{CertFile: certFile, KeyFile: keyFile},
+		HTTP2:     HTTP2{H2C: true, MaxConcurrentStreams: 10},
+		Listeners: []Listener{
+			{Name: "plain", Address: "127.0.0.1:0"},
+			{Name: "tls", Address: "127.0.0.1:0", UseSSL: true},
+		},
+	}).DisableSignals()
+	s.AddHandler("GET", "/", func(req *http.Request) []byte { return []byte(req.Proto) })
+	go s.Start(context.Background())
+	<-s.Ready()
+	defer s.Stop(context.Background())
+	addrs := map[string]string{}
+	for _, l := range s.listeners {
+		addrs[l.name] = l.listener.Addr().String()
+	}
+	get := func(client *http.Client, url string) string {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.Proto + " " + string(body)
+	}
+
+	alpn := &http.Client{Transport: &http.Transport{ForceAttemptHTTP2: true, TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	if proto := get(alpn, "https://"+addrs["tls"]+"/"); proto != "HTTP/2.0 HTTP/2.0" {
+		t.Errorf("tls listener should negotiate http/2, got %s", proto)
+	}
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	h2c := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	if proto := get(h2c, "http://"+addrs["plain"]+"/"); proto != "HTTP/2.0 HTTP/2.0" {
+		t.Errorf("plain listener should speak h2c, got %s", proto)
+	}
+	if proto := get(http.DefaultClient, "http://"+addrs["plain"]+"/"); proto != "HTTP/1.1 HTTP/1.1" {
+		t.Errorf("plain listener should keep serving http/1.1, got %s", proto)
+	}
+}
+
+func TestIdleTimeoutWithoutH2C(t *testing.T) {
+	s := NewServer(&ServerConfig{HTTP2: HTTP2{IdleTimeout: "90s"}})
+	plain := &http.Server{}
+	if err := s.configureHTTP2(plain, false); err != nil {
+		t.Fatal(err)
+	}
+	if plain.IdleTimeout != 90*time.Second || plain.Protocols != nil {
+		t.Errorf("plain listener without h2c should only get the idle timeout, got %v %v", plain.IdleTimeout, plain.Protocols)
+	}
+	s = NewServer(&ServerConfig{HTTP2: HTTP2{IdleTimeout: "soon"}})
+	if err := s.configureHTTP2(&http.Server{}, false); err == nil {
+		t.Error("invalid idle timeout accepted")
+	}
+}
@@ -0,0 +1,68 @@
+package wserver
+
+import (
+	"errors"
+	. "github.com/fitmewell/wserver/log"
+)
+
+type lifecyclePhase int
+
+const (
+	phaseInit  lifecyclePhase = iota // after the server context is opened , before the handlers are initialised
+	phaseStart                       // after the handlers are initialised , before the ports are bound
+	phaseReady                       // after the ports are bound and serving
+	phaseStop                        // at the beginning of shutdown , before in-flight requests are drained
+)
+
+var phaseNames = map[lifecyclePhase]string{phaseInit: "init", phaseStart: "start", phaseReady: "ready", phaseStop: "stop"}
+
+type lifecycleHook struct {
+	phase  lifecyclePhase
+	name   string
+	method func(ConfigContext) error
+}
+
+//run hook once the server context is initialised , such as db migrations , an error aborts the start
+func (ws *Server) OnInit(name string, method func(ConfigContext) error) *Server {
+	return ws.addHook(phaseInit, name, method)
+}
+
+//run hook before the ports are bound , such as cache warm up , an error aborts the start
+func (ws *Server) OnStart(name string, method func(ConfigContext) error) *Server {
+	return ws.addHook(phaseStart, name, method)
+}
+
+//run hook once the server is serving , such as service registration , an error stops the server
+func (ws *Server) OnReady(name string, method func(ConfigContext) error) *Server {
+	return ws.addHook(phaseReady, name, method)
+}
+
+//run hook when shutdown begins , before in-flight requests are drained , errors are reported by Stop
+func (ws *Server) OnStop(name string, method func(ConfigContext) error) *Server {
+	return ws.addHook(phaseStop, name, method)
+}
+
+func (ws *Server) addHook(phase lifecyclePhase, name string, method func(ConfigContext) error) *Server {
+	ws.hooks = append(ws.hooks, lifecycleHook{phase: phase, name: name, method: method})
+	return ws
+}
+
+//run hooks of phase in the order they are added , stop at the first error unless all is set
+func (ws *Server) runHooks(phase lifecyclePhase, all bool) error {
+	var errs []error
+	for _, hook := range ws.hooks {
+		if hook.phase != phase {
+			continue
+		}
+		Debug("[" + phaseNames[phase] + "][" + hook.name + "]start")
+		if err := hook.method(configContext(ws.context)); err != nil {
+			err = errors.New(phaseNames[phase] + " hook " + hook.name + " failed: " + err.Error())
+			Debug(err)
+			if !all {
+				return err
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
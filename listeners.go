@@ -0,0 +1,298 @@
+package wserver
+
+import (
+	"errors"
+	. "github.com/fitmewell/wserver/log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	networkSystemd    = "systemd"
+	httpListenerName  = "http"
+	httpsListenerName = "https"
+	//first file descriptor passed by socket activation
+	listenFdsStart = 3
+)
+
+//http server bound to a listener
+type serverListener struct {
+	name     string
+	server   *http.Server
+	listener net.Listener
+	tls      bool
+}
+
+//bind the configured Listeners , or Port/SSLConfig when none are configured ,
+//with neither of them sockets inherited by activation are served
+func (ws *Server) bind() ([]serverListener, error) {
+	config := ws.config
+	var listeners []serverListener
+	closeAll := func() {
+		for _, l := range listeners {
+			l.listener.Close()
+		}
+	}
+	add := func(name string, l net.Listener, handler http.Handler, tls bool, certFile, keyFile string) error {
+		server := ws.newHttpServer(l.Addr().String(), handler)
+		if tls {
+			tlsConfig, err := ws.newTLSConfig(certFile, keyFile)
+			if err != nil {
+				l.Close()
+				return err
+			}
+			server.TLSConfig = tlsConfig
+		}
+		if err := ws.configureHTTP2(server, tls); err != nil {
+			l.Close()
+			return err
+		}
+		listeners = append(listeners, serverListener{name: name, server: server, listener: l, tls: tls})
+		return nil
+	}
+
+	inherited, err := inheritedListeners()
+	if err != nil {
+		return nil, err
+	}
+	//sockets handed over by a hot restart keep their names , take them before opening new ones
+	listen := func(name, network, address string) (net.Listener, error) {
+		if l := inherited.take(name); l != nil {
+			return l, nil
+		}
+		return openListener(network, address)
+	}
+	switch {
+	case len(config.Listeners) != 0:
+		for i, lc := range config.Listeners {
+			name := lc.Name
+			if name == "" {
+				name = strconv.Itoa(i)
+			}
+			var l net.Listener
+			if lc.Network == networkSystemd {
+				if lc.Name != "" {
+					l = inherited.take(lc.Name)
+				}
+				if l == nil {
+					l = inherited.take(lc.Address)
+				}
+				if l == nil {
+					err = errors.New("no inherited socket named " + lc.Address)
+				}
+			} else {
+				l, err = listen(name, lc.Network, lc.Address)
+			}
+			if err != nil {
+				closeAll()
+				return nil, errors.New("listener " + name + ": " + err.Error())
+			}
+			certFile, keyFile := lc.CertFile, lc.KeyFile
+			if certFile == "" {
+				certFile, keyFile = config.SSLConfig.CertFile, config.SSLConfig.KeyFile
+			}
+			if err := add(name, l, newScopedHandler(ws.handler, lc.Paths, lc.ExcludePaths), lc.UseSSL, certFile, keyFile); err != nil {
+				closeAll()
+				return nil, errors.New("listener " + name + ": " + err.Error())
+			}
+		}
+	case inherited.count() != 0 && !inherited.has(httpListenerName) && !inherited.has(httpsListenerName):
+		//activated sockets replace Port and SSLConfig.SSLPort , they speak tls when UseSSL is set
+		for _, name := range inherited.names {
+			if err := add(name, inherited.take(name), ws.handler, config.UseSSL, config.SSLConfig.CertFile, config.SSLConfig.KeyFile); err != nil {
+				closeAll()
+				return nil, err
+			}
+		}
+	case config.UseSSL:
+		redirect, err := listen(httpListenerName, "tcp", ":"+config.Port)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(httpListenerName, redirect, ws.redirectHandler(), false, "", ""); err != nil {
+			return nil, err
+		}
+		l, err := listen(httpsListenerName, "tcp", ":"+config.SSLConfig.SSLPort)
+		if err == nil {
+			err = add(httpsListenerName, l, ws.handler, true, config.SSLConfig.CertFile, config.SSLConfig.KeyFile)
+		}
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+	default:
+		l, err := listen(httpListenerName, "tcp", ":"+config.Port)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(httpListenerName, l, ws.handler, false, "", ""); err != nil {
+			return nil, err
+		}
+	}
+	inherited.closeUnused()
+	return listeners, nil
+}
+
+func openListener(network string, address string) (net.Listener, error) {
+	if network == "" {
+		network = "tcp"
+	}
+	if network == "unix" {
+		//remove the socket file left by a previous run
+		if stat, err := os.Stat(address); err == nil && stat.Mode()&os.ModeSocket != 0 {
+			os.Remove(address)
+		}
+	}
+	return net.Listen(network, address)
+}
+
+/**
+  Handler restricting a listener to some paths , such as an admin listener on localhost
+*/
+type scopedHandler struct {
+	handler  http.Handler
+	paths    []string
+	excludes []string
+}
+
+func newScopedHandler(handler http.Handler, paths []string, excludes []string) http.Handler {
+	if len(paths) == 0 && len(excludes) == 0 {
+		return handler
+	}
+	scoped := &scopedHandler{handler: handler}
+	for _, path := range paths {
+		scoped.paths = append(scoped.paths, trimPathWildcard(path))
+	}
+	for _, path := range excludes {
+		scoped.excludes = append(scoped.excludes, trimPathWildcard(path))
+	}
+	return scoped
+}
+
+func (s *scopedHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if !s.allows(req.URL.Path) {
+		http.Error(resp, STATUS_NOT_FOUND.statusMessage, STATUS_NOT_FOUND.statusCode)
+		return
+	}
+	s.handler.ServeHTTP(resp, req)
+}
+
+func (s *scopedHandler) allows(path string) bool {
+	for _, exclude := range s.excludes {
+		if pathUnder(path, exclude) {
+			return false
+		}
+	}
+	if len(s.paths) == 0 {
+		return true
+	}
+	for _, allowed := range s.paths {
+		if pathUnder(path, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+  Sockets passed by systemd style activation through LISTEN_PID , LISTEN_FDS and LISTEN_FDNAMES ,
+  each one is known by its name and by its index
+*/
+type activatedListeners struct {
+	lock      sync.Mutex
+	names     []string
+	listeners map[string]net.Listener
+}
+
+var (
+	activationOnce sync.Once
+	activation     *activatedListeners
+	activationErr  error
+)
+
+//sockets inherited by this process , the environment is read once and cleared so children do not inherit it
+func inheritedListeners() (*activatedListeners, error) {
+	activationOnce.Do(func() {
+		activation, activationErr = readActivation()
+	})
+	return activation, activationErr
+}
+
+func readActivation() (*activatedListeners, error) {
+	activated := &activatedListeners{listeners: map[string]net.Listener{}}
+	fds := os.Getenv("LISTEN_FDS")
+	if fds == "" {
+		return activated, nil
+	}
+	pid := os.Getenv("LISTEN_PID")
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	//cleared even when meant for another process , so children never inherit them
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return activated, nil
+	}
+	count, err := strconv.Atoi(fds)
+	if err != nil {
+		return nil, errors.New("invalid LISTEN_FDS: " + fds)
+	}
+	for i := 0; i < count; i++ {
+		name := strconv.Itoa(i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(listenFdsStart+i), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, errors.New("inherited socket " + name + ": " + err.Error())
+		}
+		DebugF("inherited socket %s: %s", name, l.Addr())
+		activated.names = append(activated.names, name)
+		activated.listeners[name] = l
+	}
+	return activated, nil
+}
+
+func (a *activatedListeners) count() int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return len(a.listeners)
+}
+
+func (a *activatedListeners) has(name string) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	_, ok := a.listeners[name]
+	return ok
+}
+
+//hand the socket over by name or index , nil when it is unknown or already taken
+func (a *activatedListeners) take(name string) net.Listener {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if _, ok := a.listeners[name]; !ok {
+		if i, err := strconv.Atoi(name); err == nil && i >= 0 && i < len(a.names) {
+			name = a.names[i]
+		}
+	}
+	l := a.listeners[name]
+	delete(a.listeners, name)
+	return l
+}
+
+//close the inherited sockets nobody asked for
+func (a *activatedListeners) closeUnused() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for name, l := range a.listeners {
+		DebugF("closing unused inherited socket %s", name)
+		l.Close()
+		delete(a.listeners, name)
+	}
+}
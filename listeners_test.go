@@ -0,0 +1,78 @@
+package wserver
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestScopedHandler(t *testing.T) {
+	scoped := newScopedHandler(http.NotFoundHandler(), []string{"/admin/**"}, []string{"/admin/secret"}).(*scopedHandler)
+	for path, allowed := range map[string]bool{"/admin/users": true, "/admin/secret/key": false, "/": false} {
+		if scoped.allows(path) != allowed {
+			t.Errorf("%s: expected allowed %t", path, allowed)
+		}
+	}
+	if _, ok := newScopedHandler(http.NotFoundHandler(), nil, nil).(*scopedHandler); ok {
+		t.Error("unscoped listeners should use the handler as it is")
+	}
+}
+
+func TestListeners(t *testing.T) {
+	s := NewServer(&ServerConfig{Listeners: []Listener{
+		{Name: "public", Address: "127.0.0.1:0", ExcludePaths: []string{"/admin/**"}},
+		{Name: "admin", Address: "127.0.0.1:0", Paths: []string{"/admin/**"}},
+	}}).DisableSignals()
+	s.AddHandler("GET", "/admin/stats", func() []byte { return []byte("stats") })
+	go s.Start(context.Background())
+	<-s.Ready()
+	defer s.Stop(context.Background())
+	addrs := map[string]string{}
+	for _, l := range s.listeners {
+		addrs[l.name] = l.listener.Addr().String()
+	}
+	status := func(addr string) int {
+		resp, err := http.Get("http://" + addr + "/admin/stats")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := status(addrs["admin"]); code != http.StatusOK {
+		t.Errorf("admin listener should serve /admin, got %d", code)
+	}
+	if code := status(addrs["public"]); code != http.StatusNotFound {
+		t.Errorf("public listener should hide /admin, got %d", code)
+	}
+}
+
+func TestActivatedListenersUseSSL(t *testing.T) {
+	inheritedListeners()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := activation
+	activation = &activatedListeners{names: []string{"web"}, listeners: map[string]net.Listener{"web": l}}
+	defer func() { activation = previous }()
+
+	s := NewServer(&ServerConfig{UseSSL: true, SSLConfig: SSLConfig{SSLPort: "8443",
+		DevCertificate: DevCertificate{Enable: true, Dir: t.TempDir()}}}).DisableSignals()
+	s.AddHandler("GET", "/", func() []byte { return []byte("secure") })
+	go s.Start(context.Background())
+	<-s.Ready()
+	defer s.Stop(context.Background())
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get("https://" + l.Addr().String() + "/")
+	if err != nil {
+		t.Fatalf("activated socket should speak tls: %v", err)
+	}
+	defer resp.Body.Close()
+	if body, _ := ioutil.ReadAll(resp.Body); string(body) != "secure" {
+		t.Errorf("unexpected body %q", body)
+	}
+}
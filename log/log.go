@@ -1,13 +1,29 @@
 package wlog
 
-import "log"
+import (
+	"log"
+	"sync/atomic"
+)
+
+var debugDisabled atomic.Bool
+
+//turn the debug output on or off , it is on by default
+func SetDebug(enabled bool) {
+	debugDisabled.Store(!enabled)
+}
 
 func Debug(v ...interface{}) {
+	if debugDisabled.Load() {
+		return
+	}
 	v = append([]interface{}{"[DEBUG] "}, v...)
 	log.Print(v...)
 }
 
 func DebugF(format string, v ...interface{}) {
+	if debugDisabled.Load() {
+		return
+	}
 	log.Printf("[DEBUG] "+format, v...)
 }
 
@@ -0,0 +1,159 @@
+package wserver
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+const defaultConfigPath = "config.json"
+
+//key=value pairs of the repeatable -set flag
+type propertyFlags map[string]string
+
+func (p propertyFlags) String() string {
+	keys := make([]string, 0, len(p))
+	for key := range p {
+		keys = append(keys, key+"="+p[key])
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+func (p propertyFlags) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(key) == "" {
+		return errors.New("expect key=value")
+	}
+	p[strings.TrimSpace(key)] = val
+	return nil
+}
+
+//shared entrypoint of services , parse the command line , create the server , let setup add the handlers
+//and serve until SIGTERM , exit 1 when the server can not start , 2 on bad flags
+//
+//	-config file        config file , json , yaml or toml , default config.json
+//	-profile name       profile overlay , default WSERVER_PROFILE
+//	-port port          replace Port of the config
+//	-set key=value      set a property , repeatable
+//	-check-config       validate the config , load the properties files and templates , resolve the
+//	                    secrets and exit , the databases are not opened
+//	-print-routes       print the routes added by setup and exit
+func Main(setup func(*Server)) {
+	os.Exit(runMain(os.Args[1:], setup, os.Stdout, os.Stderr))
+}
+
+func runMain(args []string, setup func(*Server), stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet(commandName(), flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", defaultConfigPath, "config file , json , yaml or toml")
+	profile := flags.String("profile", "", "config profile overlay such as prod , default $"+profileEnv)
+	port := flags.String("port", "", "port replacing the one of the config")
+	properties := propertyFlags{}
+	flags.Var(properties, "set", "set property `key=value` , repeatable")
+	checkConfig := flags.Bool("check-config", false, "validate the config , properties files , templates and secrets and exit")
+	printRoutes := flags.Bool("print-routes", false, "print the routes and exit")
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if flags.NArg() != 0 {
+		fmt.Fprintln(stderr, "unexpected arguments:", strings.Join(flags.Args(), " "))
+		flags.Usage()
+		return 2
+	}
+
+	config, err := NewProfileConfig(*configPath, *profile)
+	var server *Server
+	if err == nil {
+		if *port != "" {
+			config.Port = *port
+		}
+		server, err = newConfigServer(*configPath, config)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, *configPath+": "+err.Error())
+		return 1
+	}
+	for key, value := range properties {
+		server.SetProperty(key, value)
+	}
+
+	configLock.Lock()
+	DefaultSever = server
+	configLock.Unlock()
+	//before the check , setup may add secret providers and templates
+	if setup != nil {
+		setup(server)
+	}
+	if *checkConfig {
+		if err := server.checkConfig(); err != nil {
+			fmt.Fprintln(stderr, *configPath+": "+err.Error())
+			return 1
+		}
+		fmt.Fprintln(stdout, *configPath+": ok")
+		return 0
+	}
+	if *printRoutes {
+		if err := server.printRoutes(stdout); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	}
+	if err := server.Start(context.Background()); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+//what Start checks before serving , except opening the databases and running the lifecycle hooks
+func (ws *Server) checkConfig() error {
+	if err := ws.config.Validate(); err != nil {
+		return err
+	}
+	if serverContext, ok := ws.context.(*DefaultServerContext); ok {
+		return serverContext.check()
+	}
+	return nil
+}
+
+func commandName() string {
+	if len(os.Args) == 0 {
+		return "wserver"
+	}
+	return os.Args[0]
+}
+
+//write method , path and handler of every route , including the static and health ones
+func (ws *Server) printRoutes(w io.Writer) error {
+	if err := ws.handler.init(); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	ws.handler.handlerTree.Walk(func(method string, path string, handler interface{}) {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", method, path, handlerName(handler))
+	})
+	return tw.Flush()
+}
+
+func handlerName(handler interface{}) string {
+	v := reflect.ValueOf(handler)
+	if v.Kind() == reflect.Func {
+		if f := runtime.FuncForPC(v.Pointer()); f != nil {
+			return f.Name()
+		}
+	}
+	return fmt.Sprintf("%T", handler)
+}
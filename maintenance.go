@@ -0,0 +1,125 @@
+package wserver
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//property switching the whole server into maintenance when set to true
+const MaintenanceProperty = "wserver.maintenance"
+
+/**
+  Runtime maintenance switch , requests under the maintained paths get 503 unless
+  the client is allowlisted or the path is excluded
+*/
+type maintenanceMode struct {
+	lock       sync.RWMutex
+	enabled    bool
+	paths      []string
+	allow      ipNets
+	exclude    []string
+	retryAfter string
+	template   string
+}
+
+func newMaintenanceMode(config Maintenance) *maintenanceMode {
+	m := &maintenanceMode{}
+	m.set(config.Enable, config.Paths...)
+	return m
+}
+
+//parse the static part of the config , the switch itself is kept
+func (m *maintenanceMode) configure(config Maintenance) error {
+	allow, err := parseIPNets(config.Allow)
+	if err != nil {
+		return err
+	}
+	retryAfter := ""
+	if config.RetryAfter != "" {
+		d, err := time.ParseDuration(config.RetryAfter)
+		if err != nil {
+			return err
+		}
+		retryAfter = strconv.Itoa(int(d.Seconds()))
+	}
+	exclude := make([]string, 0, len(config.ExcludePaths))
+	for _, path := range config.ExcludePaths {
+		exclude = append(exclude, trimPathWildcard(path))
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.allow = allow
+	m.exclude = exclude
+	m.retryAfter = retryAfter
+	m.template = config.Template
+	return nil
+}
+
+//switch maintenance on or off , no paths means the whole server
+func (m *maintenanceMode) set(enabled bool, paths ...string) {
+	trimmed := make([]string, 0, len(paths))
+	for _, path := range paths {
+		trimmed = append(trimmed, trimPathWildcard(path))
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.enabled = enabled
+	m.paths = trimmed
+}
+
+func (m *maintenanceMode) isEnabled() bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.enabled
+}
+
+//answer 503 when req is under maintenance , return false to let it go on
+func (m *maintenanceMode) serve(context ServletContext, resp http.ResponseWriter, req *http.Request) bool {
+	m.lock.RLock()
+	enabled, paths := m.enabled, m.paths
+	if !enabled && context.GetProperty(MaintenanceProperty) == "true" {
+		enabled, paths = true, nil
+	}
+	if !enabled || !m.covers(req.URL.Path, paths) || m.allow.contains(net.ParseIP(context.GetClientIP())) {
+		m.lock.RUnlock()
+		return false
+	}
+	retryAfter, name := m.retryAfter, m.template
+	m.lock.RUnlock()
+
+	if retryAfter != "" {
+		resp.Header().Set("Retry-After", retryAfter)
+	}
+	if name != "" {
+		resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+		resp.WriteHeader(STATUS_SERVICE_UNAVAILABLE.statusCode)
+		context.SetData("RetryAfter", retryAfter)
+		if err := context.ExecuteTemplate(resp, name, context.GetData()); err == nil {
+			return true
+		}
+		resp.Write([]byte(STATUS_SERVICE_UNAVAILABLE.statusMessage))
+		return true
+	}
+	http.Error(resp, STATUS_SERVICE_UNAVAILABLE.statusMessage, STATUS_SERVICE_UNAVAILABLE.statusCode)
+	return true
+}
+
+func (m *maintenanceMode) covers(path string, paths []string) bool {
+	for _, exclude := range m.exclude {
+		if pathUnder(path, exclude) {
+			return false
+		}
+	}
+	if len(paths) == 0 {
+		return true
+	}
+	for _, maintained := range paths {
+		if pathUnder(path, maintained) {
+			return true
+		}
+	}
+	return false
+}
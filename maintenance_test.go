@@ -0,0 +1,88 @@
+package wserver
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMaintenance(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "maintenance.html"), []byte(`{{define "maintenance"}}back in {{.RetryAfter}}s{{end}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(&ServerConfig{
+		Templates: []Template{{Name: "default", Dir: dir}},
+		Health:    Health{Enable: true},
+		Maintenance: Maintenance{
+			Allow:      []string{"10.0.0.0/8"},
+			RetryAfter: "10m",
+			Template:   "maintenance",
+		},
+	})
+	s.AddHandler("GET", "/shop/cart", func() []byte { return []byte("cart") })
+	s.AddHandler("GET", "/blog", func() []byte { return []byte("blog") })
+	if err := openContext(s.context); err != nil {
+		t.Fatal(err)
+	}
+	defer closeContext(s.context)
+	initTestHandler(t, s)
+
+	cases := []struct {
+		name     string
+		enabled  bool
+		paths    []string
+		property string
+		path     string
+		ip       string
+		code     int
+		body     string
+	}{
+		{"off", false, nil, "", "/shop/cart", "192.0.2.1", http.StatusOK, "cart"},
+		{"whole server", true, nil, "", "/blog", "192.0.2.1", http.StatusServiceUnavailable, "back in 600s"},
+		{"allowlisted ip", true, nil, "", "/blog", "10.1.2.3", http.StatusOK, "blog"},
+		{"health path", true, nil, "", "/livez", "192.0.2.1", http.StatusOK, ""},
+		{"route group", true, []string{"/shop/**"}, "", "/shop/cart", "192.0.2.1", http.StatusServiceUnavailable, "back in 600s"},
+		{"outside route group", true, []string{"/shop/**"}, "", "/blog", "192.0.2.1", http.StatusOK, "blog"},
+		{"property", false, nil, "true", "/blog", "192.0.2.1", http.StatusServiceUnavailable, "back in 600s"},
+		{"property off", false, nil, "false", "/blog", "192.0.2.1", http.StatusOK, "blog"},
+	}
+	for _, c := range cases {
+		s.SetMaintenance(c.enabled, c.paths...)
+		s.SetProperty(MaintenanceProperty, c.property)
+		if s.InMaintenance() != c.enabled {
+			t.Errorf("%s: InMaintenance() = %v", c.name, s.InMaintenance())
+		}
+		req := httptest.NewRequest("GET", c.path, nil)
+		req.RemoteAddr = c.ip + ":4000"
+		rec := httptest.NewRecorder()
+		s.handler.ServeHTTP(rec, req)
+		if rec.Code != c.code || !strings.Contains(rec.Body.String(), c.body) {
+			t.Errorf("%s: expected %d %q, got %d %q", c.name, c.code, c.body, rec.Code, rec.Body.String())
+		}
+		retryAfter := ""
+		if c.code == http.StatusServiceUnavailable {
+			retryAfter = "600"
+		}
+		if rec.Header().Get("Retry-After") != retryAfter {
+			t.Errorf("%s: expected Retry-After %q, got %q", c.name, retryAfter, rec.Header().Get("Retry-After"))
+		}
+	}
+}
+
+func TestMaintenanceWithoutTemplate(t *testing.T) {
+	s := NewServer(&ServerConfig{Maintenance: Maintenance{Enable: true}})
+	s.AddHandler("GET", "/", func() []byte { return []byte("ok") })
+	initTestHandler(t, s)
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "" {
+		t.Errorf("expected a plain 503 without Retry-After, got %d %v", rec.Code, rec.Header())
+	}
+	if err := s.handler.maintenance.configure(Maintenance{RetryAfter: "soon"}); err == nil {
+		t.Error("invalid RetryAfter accepted")
+	}
+}
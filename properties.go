@@ -0,0 +1,185 @@
+package wserver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+//one key/value pair of a properties file , line is where its logical line starts
+type property struct {
+	key   string
+	value string
+	line  int
+}
+
+//error of a malformed properties file
+type PropertiesError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *PropertiesError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+}
+
+//parse content like java.util.Properties.load : # and ! comments , = : or whitespace separators ,
+//backslash line continuations , escapes including \uXXXX , and \n , \r\n or \r line endings
+func parseProperties(file string, content string) ([]property, error) {
+	content = strings.TrimPrefix(content, "\uFEFF")
+	var properties []property
+	lines := splitPropertiesLines(content)
+	for i := 0; i < len(lines); i++ {
+		start := i
+		line := strings.TrimLeft(lines[i], " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		//columns of the logical line map back to the natural line they come from
+		columns := []lineOffset{{at: 0, line: i + 1, column: len(lines[i]) - len(line) + 1}}
+		for continues(line) && i+1 < len(lines) {
+			i++
+			next := strings.TrimLeft(lines[i], " \t\f")
+			line = line[:len(line)-1]
+			columns = append(columns, lineOffset{at: len(line), line: i + 1, column: len(lines[i]) - len(next) + 1})
+			line += next
+		}
+		if continues(line) {
+			//a continuation at the end of the file continues with nothing
+			line = line[:len(line)-1]
+		}
+		keyEnd := propertyKeyEnd(line)
+		valueStart := keyEnd
+		for valueStart < len(line) && isPropertySpace(line[valueStart]) {
+			valueStart++
+		}
+		if valueStart < len(line) && (line[valueStart] == '=' || line[valueStart] == ':') {
+			valueStart++
+		}
+		for valueStart < len(line) && isPropertySpace(line[valueStart]) {
+			valueStart++
+		}
+		key, err := unescapeProperty(line[:keyEnd], 0)
+		if err == nil {
+			var value string
+			if value, err = unescapeProperty(line[valueStart:], valueStart); err == nil {
+				properties = append(properties, property{key: key, value: value, line: start + 1})
+				continue
+			}
+		}
+		e := err.(*PropertiesError)
+		e.File = file
+		e.Line, e.Column = position(columns, e.Column)
+		return nil, e
+	}
+	return properties, nil
+}
+
+type lineOffset struct {
+	at     int
+	line   int
+	column int
+}
+
+//line and column of offset in a logical line
+func position(offsets []lineOffset, offset int) (int, int) {
+	current := offsets[0]
+	for _, o := range offsets {
+		if o.at <= offset {
+			current = o
+		}
+	}
+	return current.line, current.column + offset - current.at
+}
+
+func splitPropertiesLines(content string) []string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.ReplaceAll(content, "\r", "\n")
+	return strings.Split(content, "\n")
+}
+
+//an odd number of trailing backslashes joins the next line
+func continues(line string) bool {
+	count := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		count++
+	}
+	return count%2 == 1
+}
+
+func isPropertySpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\f'
+}
+
+//the key ends at the first unescaped separator or whitespace
+func propertyKeyEnd(line string) int {
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\':
+			i++
+		case c == '=' || c == ':' || isPropertySpace(c):
+			return i
+		}
+	}
+	return len(line)
+}
+
+//resolve the escapes of s , offset is the position of s in its logical line for errors
+func unescapeProperty(s string, offset int) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			r, err := unicodeEscape(s, i+1)
+			if err != nil {
+				return "", &PropertiesError{Column: offset + i - 1, Message: err.Error()}
+			}
+			i += 4
+			//a surrogate pair spans two escapes
+			if utf16.IsSurrogate(r) && strings.HasPrefix(s[i+1:], "\\u") {
+				if low, err := unicodeEscape(s, i+3); err == nil {
+					if pair := utf16.DecodeRune(r, low); pair != utf8.RuneError {
+						r = pair
+						i += 6
+					}
+				}
+			}
+			b.WriteRune(r)
+		default:
+			//any other escaped character stands for itself
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+func unicodeEscape(s string, at int) (rune, error) {
+	if at+4 > len(s) {
+		return 0, fmt.Errorf("malformed \\uxxxx encoding")
+	}
+	code, err := strconv.ParseUint(s[at:at+4], 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("malformed \\uxxxx encoding \\u%s", s[at:at+4])
+	}
+	return rune(code), nil
+}
@@ -0,0 +1,166 @@
+package wserver
+
+import (
+	"errors"
+	. "github.com/fitmewell/wserver/log"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//what the typed accessors need from a context
+type propertySource interface {
+	GetProperty(string) string
+	ContainsProperty(string) bool
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func propertyInt(source propertySource, key string, def int) int {
+	if !source.ContainsProperty(key) {
+		return def
+	}
+	value, err := strconv.Atoi(strings.TrimSpace(source.GetProperty(key)))
+	if err != nil {
+		Debug("property ", key, " is no int , using ", def)
+		return def
+	}
+	return value
+}
+
+func propertyBool(source propertySource, key string, def bool) bool {
+	if !source.ContainsProperty(key) {
+		return def
+	}
+	value, err := strconv.ParseBool(strings.TrimSpace(source.GetProperty(key)))
+	if err != nil {
+		Debug("property ", key, " is no bool , using ", def)
+		return def
+	}
+	return value
+}
+
+func propertyDuration(source propertySource, key string, def time.Duration) time.Duration {
+	if !source.ContainsProperty(key) {
+		return def
+	}
+	value, err := time.ParseDuration(strings.TrimSpace(source.GetProperty(key)))
+	if err != nil {
+		Debug("property ", key, " is no duration , using ", def)
+		return def
+	}
+	return value
+}
+
+func propertyStringSlice(source propertySource, key string, def []string) []string {
+	if !source.ContainsProperty(key) {
+		return def
+	}
+	return splitList(source.GetProperty(key))
+}
+
+//comma separated items , trimmed and without empty ones
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+/**
+  Fill the fields of the struct target points to from the properties under prefix , a field is read from
+  the key of its prop tag or its name with a lower case first letter , with options:
+
+    Host    string        `prop:"host,required"`
+    Port    int           `prop:"port" default:"25"`
+    Timeout time.Duration `prop:"timeout" default:"10s"`
+    To      []string      `prop:"to"` //comma separated
+    TLS     TLSOptions    `prop:"tls"` //nested struct read from prefix.tls.*
+    Ignored string        `prop:"-"`
+
+  Every missing required property and malformed value is reported , then the Validate() error method of
+  target runs when it has one
+*/
+func bindProperties(source propertySource, prefix string, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.New("BindProperties needs a pointer to a struct , got " + reflect.TypeOf(target).String())
+	}
+	var errs []error
+	bindStruct(source, prefix, v.Elem(), &errs)
+	if len(errs) == 0 {
+		if validator, ok := target.(interface{ Validate() error }); ok {
+			if err := validator.Validate(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func bindStruct(source propertySource, prefix string, v reflect.Value, errs *[]error) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("prop"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name[:1]) + field.Name[1:]
+		}
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+			bindStruct(source, key, v.Field(i), errs)
+			continue
+		}
+		value, found := source.GetProperty(key), source.ContainsProperty(key)
+		if !found {
+			if def, ok := field.Tag.Lookup("default"); ok {
+				value, found = def, true
+			}
+		}
+		if !found {
+			if options == "required" {
+				*errs = append(*errs, errors.New("property "+key+" is required"))
+			}
+			continue
+		}
+		if err := setProperty(v.Field(i), value); err != nil {
+			*errs = append(*errs, errors.New("property "+key+": "+err.Error()))
+		}
+	}
+}
+
+func setProperty(v reflect.Value, value string) error {
+	if v.Kind() != reflect.String {
+		value = strings.TrimSpace(value)
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	if v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64 {
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+		return nil
+	}
+	//strings , bools , integers and string lists are set like config values
+	return setConfigValue(v, value)
+}
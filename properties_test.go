@@ -0,0 +1,205 @@
+package wserver
+
+import (
+	"errors"
+	"github.com/fitmewell/wserver/bdb"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseProperties(t *testing.T) {
+	content := "\n" +
+		"# comment\r\n" +
+		"   ! another comment\r\n" +
+		"key1=value1\r\n" +
+		"key2 : value2 with spaces \n" +
+		"key3 value3\n" +
+		"  key4=\n" +
+		"key5\n" +
+		"multi = first, \\\n" +
+		"        second, \\\n" +
+		"        third\n" +
+		"escaped\\ key\\:x = a\\=b\\tc\\\\\n" +
+		"unicode=caf\\u00e9 \\uD83D\\uDE00\r" +
+		"url=http://example.com/?a=b\n" +
+		"last=end\\"
+	parsed, err := parseProperties("app.properties", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"key1":          "value1",
+		"key2":          "value2 with spaces ",
+		"key3":          "value3",
+		"key4":          "",
+		"key5":          "",
+		"multi":         "first, second, third",
+		"escaped key:x": "a=b\tc\\",
+		"unicode":       "café 😀",
+		"url":           "http://example.com/?a=b",
+		"last":          "end",
+	}
+	if len(parsed) != len(expected) {
+		t.Errorf("expected %d properties, got %+v", len(expected), parsed)
+	}
+	for _, p := range parsed {
+		if value, ok := expected[p.key]; !ok || value != p.value {
+			t.Errorf("%q: expected %q, got %q", p.key, value, p.value)
+		}
+	}
+	if parsed[0].key != "key1" || parsed[0].line != 4 || parsed[5].key != "multi" || parsed[5].line != 9 {
+		t.Errorf("unexpected lines %+v", parsed[:6])
+	}
+}
+
+func TestParsePropertiesErrors(t *testing.T) {
+	_, err := parseProperties("app.properties", "a=1\nlong = first \\\n   bad\\u12x4\n")
+	e, ok := err.(*PropertiesError)
+	if !ok || e.File != "app.properties" || e.Line != 3 || e.Column != 7 {
+		t.Errorf("expected an error at app.properties:3:7, got %v", err)
+	}
+}
+
+func TestLoadPropertiesDir(t *testing.T) {
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "a.properties"), []byte("a=1\nshared=a"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "b.properties"), []byte("b=2\nshared=b"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "c.txt"), []byte("c=3"), 0600)
+	os.Mkdir(filepath.Join(dir, "d.properties"), 0700)
+	properties, err := loadProperties(PropertiesConfig{PropertiesFiles: []PropertiesFile{{Locate: dir}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if properties["a"] != "1" || properties["b"] != "2" || properties["shared"] != "b" || properties["c"] != "" {
+		t.Errorf("unexpected properties %v", properties)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "b.properties"), []byte("b=\\uZZZZ"), 0600)
+	_, err = loadProperties(PropertiesConfig{PropertiesFiles: []PropertiesFile{{Locate: dir}}})
+	if err == nil || !strings.Contains(err.Error(), "b.properties:1:3") {
+		t.Errorf("expected the position of the bad escape, got %v", err)
+	}
+}
+
+type mailTLS struct {
+	Enable bool
+	CAFile string `prop:"caFile"`
+}
+
+type mailConfig struct {
+	Host     string        `prop:"host,required"`
+	Port     int           `prop:"port" default:"25"`
+	Timeout  time.Duration `prop:"timeout" default:"10s"`
+	To       []string      `prop:"to"`
+	Rate     float64
+	TLS      mailTLS `prop:"tls"`
+	Password string  `prop:"-"`
+}
+
+func (c *mailConfig) Validate() error {
+	if c.Port == 0 {
+		return errors.New("port must not be 0")
+	}
+	return nil
+}
+
+func TestTypedProperties(t *testing.T) {
+	context := &DefaultServerContext{properties: map[string]string{
+		"mail.host":       "smtp.example.com",
+		"mail.timeout":    "1m",
+		"mail.to":         "a@example.com, b@example.com,",
+		"mail.rate":       "0.5",
+		"mail.tls.enable": "true",
+		"mail.tls.caFile": "/etc/ca.pem",
+		"mail.password":   "secret",
+		"retries":         " 3 ",
+		"bad":             "x",
+	}}
+	if context.GetInt("retries", 1) != 3 || context.GetInt("bad", 1) != 1 || context.GetInt("missing", 7) != 7 {
+		t.Error("unexpected GetInt")
+	}
+	if !context.GetBool("mail.tls.enable", false) || !context.GetBool("bad", true) {
+		t.Error("unexpected GetBool")
+	}
+	if context.GetDuration("mail.timeout", 0) != time.Minute || context.GetDuration("missing", time.Second) != time.Second {
+		t.Error("unexpected GetDuration")
+	}
+	if to := context.GetStringSlice("mail.to", nil); len(to) != 2 || to[1] != "b@example.com" {
+		t.Errorf("unexpected GetStringSlice %v", to)
+	}
+
+	config := &mailConfig{}
+	if err := context.BindProperties("mail", config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Host != "smtp.example.com" || config.Port != 25 || config.Timeout != time.Minute || len(config.To) != 2 ||
+		config.Rate != 0.5 || !config.TLS.Enable || config.TLS.CAFile != "/etc/ca.pem" || config.Password != "" {
+		t.Errorf("unexpected binding %+v", config)
+	}
+
+	context.properties = map[string]string{"mail.port": "abc", "mail.timeout": "soon"}
+	err := context.BindProperties("mail", &mailConfig{})
+	for _, expected := range []string{"property mail.host is required", "property mail.port:", "property mail.timeout:"} {
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in %v", expected, err)
+		}
+	}
+	context.properties = map[string]string{"mail.host": "h", "mail.port": "0"}
+	if err := context.BindProperties("mail", &mailConfig{}); err == nil || !strings.Contains(err.Error(), "port must not be 0") {
+		t.Errorf("expected the Validate error, got %v", err)
+	}
+	if err := context.BindProperties("mail", mailConfig{}); err == nil {
+		t.Error("binding to a struct value should fail")
+	}
+}
+
+//a ServerContext with only the original methods
+type mapContext map[string]string
+
+func (c mapContext) GetDb() bdb.BufferedDB {
+	return nil
+}
+
+func (c mapContext) GetSelectDb(string) bdb.BufferedDB {
+	return nil
+}
+
+func (c mapContext) ExecuteTemplate(io.Writer, string, interface{}) error {
+	return nil
+}
+
+func (c mapContext) GetProperty(key string) string {
+	return c[key]
+}
+
+func (c mapContext) Init() {
+}
+
+func (c mapContext) ContainsProperty(key string) bool {
+	_, ok := c[key]
+	return ok
+}
+
+func TestCustomServerContext(t *testing.T) {
+	context := configContext(mapContext{"retries": "3", "mail.host": "h", "mail.port": "26"})
+	if context.GetInt("retries", 1) != 3 || context.GetProfile() != "" {
+		t.Error("unexpected accessors of a custom context")
+	}
+	config := &mailConfig{}
+	if err := context.BindProperties("mail", config); err != nil || config.Host != "h" || config.Port != 26 {
+		t.Errorf("unexpected binding %+v %v", config, err)
+	}
+	context.AddChangeListener(func(ConfigChange) {})
+	servlet := &DefaultServletContext{ServerContext: mapContext{"retries": "4"}}
+	if servlet.GetInt("retries", 1) != 4 {
+		t.Error("servlet context should read the properties of a custom context")
+	}
+	if err := openContext(mapContext{}); err != nil || closeContext(mapContext{}) != nil {
+		t.Error("a context without Open and Close should open and close")
+	}
+}
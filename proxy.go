@@ -0,0 +1,178 @@
+package wserver
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+//list of networks , plain ips are taken as single host networks
+type ipNets []*net.IPNet
+
+func parseIPNets(cidrs []string) (ipNets, error) {
+	nets := ipNets{}
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, errors.New("invalid ip or cidr: " + cidr)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, network)
+	}
+	return nets, nil
+}
+
+func (nets ipNets) contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range nets {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+  Resolve the client address , scheme and host of a request , forwarded headers are only
+  believed when the direct peer is a trusted proxy
+*/
+type proxyResolver struct {
+	trusted ipNets
+}
+
+func newProxyResolver(trustedProxies []string) (*proxyResolver, error) {
+	trusted, err := parseIPNets(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return &proxyResolver{trusted: trusted}, nil
+}
+
+//client ip of req , the right most forwarded address not belonging to a trusted proxy
+func (p *proxyResolver) clientIP(req *http.Request) string {
+	remote := remoteIP(req)
+	if !p.isTrusted(remote) {
+		return remote
+	}
+	if hop := p.clientHop(req); hop != nil {
+		if ip := hop["for"]; ip != "" {
+			return stripPort(ip)
+		}
+		return remote
+	}
+	chain := headerList(req.Header, "X-Forwarded-For")
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := stripPort(chain[i])
+		if !p.isTrusted(ip) || i == 0 {
+			return ip
+		}
+	}
+	return remote
+}
+
+//http or https as seen by the client
+func (p *proxyResolver) scheme(req *http.Request) string {
+	if proto := p.forwarded(req, "proto", "X-Forwarded-Proto"); proto != "" {
+		return strings.ToLower(proto)
+	}
+	if req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+//host as requested by the client , may include a port
+func (p *proxyResolver) host(req *http.Request) string {
+	if host := p.forwarded(req, "host", "X-Forwarded-Host"); host != "" {
+		return host
+	}
+	return req.Host
+}
+
+//forwarded parameter key of the client hop , or the right most value of header , the one set by the
+//nearest proxy , the left most values may come from the client itself
+func (p *proxyResolver) forwarded(req *http.Request, key string, header string) string {
+	if !p.isTrusted(remoteIP(req)) {
+		return ""
+	}
+	if hop := p.clientHop(req); hop[key] != "" {
+		return hop[key]
+	}
+	if values := headerList(req.Header, header); len(values) != 0 {
+		return values[len(values)-1]
+	}
+	return ""
+}
+
+//element of the Forwarded header added for the client , the right most one whose for is not a trusted proxy ,
+//nil without Forwarded header
+func (p *proxyResolver) clientHop(req *http.Request) map[string]string {
+	elements := forwardedElements(req)
+	for i := len(elements) - 1; i >= 0; i-- {
+		if ip, ok := elements[i]["for"]; (ok && !p.isTrusted(stripPort(ip))) || i == 0 {
+			return elements[i]
+		}
+	}
+	return nil
+}
+
+func (p *proxyResolver) isTrusted(ip string) bool {
+	return p != nil && p.trusted.contains(net.ParseIP(ip))
+}
+
+func remoteIP(req *http.Request) string {
+	return stripPort(req.RemoteAddr)
+}
+
+//strip port and brackets from host:port , [ipv6]:port or a bare address
+func stripPort(address string) string {
+	address = strings.TrimSpace(address)
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+}
+
+//comma separated values of every header line of name
+func headerList(header http.Header, name string) []string {
+	var values []string
+	for _, line := range header[http.CanonicalHeaderKey(name)] {
+		for _, value := range strings.Split(line, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+//parameters of the elements of the RFC 7239 Forwarded header , one element per hop , keys in lower case
+func forwardedElements(req *http.Request) []map[string]string {
+	var elements []map[string]string
+	for _, element := range headerList(req.Header, "Forwarded") {
+		parameters := map[string]string{}
+		for _, pair := range strings.Split(element, ";") {
+			if name, value, ok := strings.Cut(strings.TrimSpace(pair), "="); ok {
+				parameters[strings.ToLower(name)] = strings.Trim(value, `"`)
+			}
+		}
+		elements = append(elements, parameters)
+	}
+	return elements
+}
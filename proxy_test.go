@@ -0,0 +1,94 @@
+package wserver
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProxyResolver(t *testing.T) {
+	resolver, err := newProxyResolver([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "203.0.113.9:4000"
+	req.Header.Set("X-Forwarded-For", "1.1.1.1")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	if ip := resolver.clientIP(req); ip != "203.0.113.9" {
+		t.Errorf("untrusted peer should not be able to spoof, got %s", ip)
+	}
+	if scheme := resolver.scheme(req); scheme != "http" {
+		t.Errorf("untrusted peer should not set the scheme, got %s", scheme)
+	}
+
+	req.RemoteAddr = "10.1.2.3:4000"
+	req.Header.Set("X-Forwarded-For", "1.1.1.1, 198.51.100.7, 192.168.1.1")
+	req.Header.Set("X-Forwarded-Host", "example.com")
+	if ip := resolver.clientIP(req); ip != "198.51.100.7" {
+		t.Errorf("expected right most untrusted address, got %s", ip)
+	}
+	if scheme := resolver.scheme(req); scheme != "https" {
+		t.Errorf("expected forwarded scheme, got %s", scheme)
+	}
+	if host := resolver.host(req); host != "example.com" {
+		t.Errorf("expected forwarded host, got %s", host)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.1.2.3:4000"
+	req.Header.Set("Forwarded", `for="[2001:db8::1]:1234";proto=https, for=10.0.0.2`)
+	if ip := resolver.clientIP(req); ip != "2001:db8::1" {
+		t.Errorf("expected address from Forwarded, got %s", ip)
+	}
+}
+
+func TestForwardedSpoofing(t *testing.T) {
+	resolver, err := newProxyResolver([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.1.2.3:4000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	req.Header.Add("X-Forwarded-Host", "evil.example")
+	req.Header.Add("X-Forwarded-Host", "example.com")
+	req.Header.Set("X-Forwarded-Proto", "http, https")
+	if host, scheme := resolver.host(req), resolver.scheme(req); host != "example.com" || scheme != "https" {
+		t.Errorf("client supplied left most values should be ignored, got %s %s", host, scheme)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.1.2.3:4000"
+	req.Header.Set("Forwarded", `for=1.1.1.1;host=evil.example;proto=http, for=198.51.100.7;host=example.com;proto=https, for=10.0.0.2;host=internal`)
+	if ip, host, scheme := resolver.clientIP(req), resolver.host(req), resolver.scheme(req); ip != "198.51.100.7" || host != "example.com" || scheme != "https" {
+		t.Errorf("expected the values of the client hop, got %s %s %s", ip, host, scheme)
+	}
+}
+
+func TestAccessAspect(t *testing.T) {
+	aspect, err := newAccessAspect([]AccessRule{
+		{Path: "/", Deny: []string{"203.0.113.0/24"}},
+		{Path: "/admin/**", Allow: []string{"127.0.0.1", "::1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		path    string
+		ip      string
+		allowed bool
+	}{
+		{"/", "198.51.100.1", true},
+		{"/", "203.0.113.5", false},
+		{"/admin/users", "127.0.0.1", true},
+		{"/admin/users", "198.51.100.1", false},
+		{"/administrator", "198.51.100.1", true},
+	}
+	for _, c := range cases {
+		if got := aspect.allowed(c.path, net.ParseIP(c.ip)); got != c.allowed {
+			t.Errorf("allowed(%s, %s) = %v", c.path, c.ip, got)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package wserver
+
+import (
+	"errors"
+	. "github.com/fitmewell/wserver/log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultReloadInterval = 2 * time.Second
+
+//what a reload changed , passed to the listeners added by ConfigContext.AddChangeListener
+type ConfigChange struct {
+	//keys of the properties added , changed or removed
+	Properties      []string
+	Templates       bool
+	StaticResources bool
+	LogLevel        bool
+}
+
+func (c ConfigChange) empty() bool {
+	return len(c.Properties) == 0 && !c.Templates && !c.StaticResources && !c.LogLevel
+}
+
+//load the config file again , when the server was created from one , and the properties files ,
+//then swap properties , templates , static resources and the log level , other settings need a restart
+func (ws *Server) Reload() error {
+	ws.reloadLock.Lock()
+	defer ws.reloadLock.Unlock()
+	ws.lock.Lock()
+	started := ws.started
+	config := *ws.config
+	overrides := make(map[string]string, len(ws.overrides))
+	for key, value := range ws.overrides {
+		overrides[key] = value
+	}
+	addedTemplates := append([]Template{}, ws.addedTemplates...)
+	addedStaticResources := append([]StaticResource{}, ws.addedStaticResources...)
+	ws.lock.Unlock()
+	if !started {
+		return errors.New("Server not started")
+	}
+	serverContext, ok := ws.context.(*DefaultServerContext)
+	if !ok {
+		return errors.New("reload needs the default server context")
+	}
+
+	if ws.configPath != "" {
+		loaded, err := NewProfileConfig(ws.configPath, config.Profile)
+		if err == nil {
+			err = loaded.Validate()
+		}
+		if err != nil {
+			return errors.New("config not reloaded: " + err.Error())
+		}
+		config.PropertiesConfig = loaded.PropertiesConfig
+		//keep what was added in code , such as by the setup of Main
+		config.Templates = append(loaded.Templates, addedTemplates...)
+		config.StaticResources = append(loaded.StaticResources, addedStaticResources...)
+		config.LogLevel = loaded.LogLevel
+	}
+	properties, err := loadProperties(config.PropertiesConfig)
+	if err == nil {
+		for key, value := range overrides {
+			properties[key] = value
+		}
+		err = ws.secrets.resolveProperties(properties)
+	}
+	if err != nil {
+		return errors.New("config not reloaded: " + err.Error())
+	}
+	temp, err := loadTemplates(config.Templates)
+	if err != nil {
+		return errors.New("config not reloaded: " + err.Error())
+	}
+	templatesPrint := fingerprint(templateDirs(config.Templates))
+
+	//everything is loaded , swap it in
+	ws.lock.Lock()
+	change := ConfigChange{
+		Templates:       templatesPrint != ws.templatesPrint || !reflect.DeepEqual(config.Templates, ws.config.Templates),
+		StaticResources: !reflect.DeepEqual(config.StaticResources, ws.config.StaticResources),
+		LogLevel:        config.LogLevel != ws.config.LogLevel,
+	}
+	ws.config.PropertiesConfig = config.PropertiesConfig
+	ws.config.Templates = config.Templates
+	ws.config.StaticResources = config.StaticResources
+	ws.config.LogLevel = config.LogLevel
+	ws.templatesPrint = templatesPrint
+	ws.lock.Unlock()
+
+	serverContext.lock.Lock()
+	change.Properties = changedProperties(serverContext.properties, properties)
+	serverContext.properties = properties
+	serverContext.template = temp
+	listeners := append([]func(ConfigChange){}, serverContext.changeListeners...)
+	serverContext.lock.Unlock()
+
+	if change.StaticResources {
+		ws.handler.setStaticResources(config.StaticResources)
+	}
+	if change.LogLevel {
+		applyLogLevel(config.LogLevel)
+	}
+	if change.empty() {
+		Debug("reloaded , nothing changed")
+		return nil
+	}
+	DebugF("reloaded , changed properties: %v templates: %t static resources: %t log level: %t",
+		change.Properties, change.Templates, change.StaticResources, change.LogLevel)
+	//cached responses may render the old values
+	ws.PurgeCache()
+	for _, listener := range listeners {
+		listener(change)
+	}
+	return nil
+}
+
+//poll the config file , properties files and template dirs every HotReload.Interval and reload on change
+func (ws *Server) watchConfig() error {
+	config := ws.config.HotReload
+	ws.templatesPrint = fingerprint(templateDirs(ws.config.Templates))
+	if !config.Enable {
+		return nil
+	}
+	interval := defaultReloadInterval
+	if config.Interval != "" {
+		var err error
+		if interval, err = time.ParseDuration(config.Interval); err != nil {
+			return err
+		}
+	}
+	last := fingerprint(ws.watchedPaths())
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				current := fingerprint(ws.watchedPaths())
+				if current == last {
+					continue
+				}
+				last = current
+				if err := ws.Reload(); err != nil {
+					Debug(err)
+				}
+			case <-ws.stopped:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (ws *Server) watchedPaths() []string {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	var paths []string
+	if ws.configPath != "" {
+		paths = append(paths, ws.configPath)
+		if ws.config.Profile != "" {
+			paths = append(paths, profileConfigPath(ws.configPath, ws.config.Profile))
+		}
+	}
+	for _, pf := range ws.config.PropertiesConfig.PropertiesFiles {
+		paths = append(paths, pf.Locate)
+	}
+	return append(paths, templateDirs(ws.config.Templates)...)
+}
+
+func templateDirs(templates []Template) []string {
+	var dirs []string
+	for _, t := range templates {
+		dirs = append(dirs, t.Dir)
+	}
+	return dirs
+}
+
+//size and modification time of every path , and of the files of directories
+func fingerprint(paths []string) string {
+	var b strings.Builder
+	var add func(path string, descend bool)
+	add = func(path string, descend bool) {
+		stat, err := os.Stat(path)
+		if err != nil {
+			b.WriteString(path + " missing\n")
+			return
+		}
+		b.WriteString(path + " " + strconv.FormatInt(stat.Size(), 10) + " " + strconv.FormatInt(stat.ModTime().UnixNano(), 10) + "\n")
+		if stat.IsDir() && descend {
+			entries, _ := filepath.Glob(filepath.Join(path, "*"))
+			sort.Strings(entries)
+			for _, entry := range entries {
+				add(entry, false)
+			}
+		}
+	}
+	for _, path := range paths {
+		add(path, true)
+	}
+	return b.String()
+}
+
+//keys whose value differs between old and new , sorted
+func changedProperties(old map[string]string, new map[string]string) []string {
+	var keys []string
+	for key, value := range new {
+		if oldValue, ok := old[key]; !ok || oldValue != value {
+			keys = append(keys, key)
+		}
+	}
+	for key := range old {
+		if _, ok := new[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//"error" hides the debug output , "debug" (default) shows it
+func applyLogLevel(level string) {
+	SetDebug(level != "error")
+}
@@ -0,0 +1,354 @@
+package wserver
+
+import (
+	"bytes"
+	"container/list"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCacheMaxEntries    = 1000
+	defaultCacheMaxBytes      = 64 << 20
+	defaultCacheMaxEntryBytes = 1 << 20
+)
+
+type cacheRoute struct {
+	path string
+	ttl  time.Duration
+	vary []string
+}
+
+type cacheEntry struct {
+	key     string
+	base    string
+	path    string
+	status  int
+	header  http.Header
+	body    []byte
+	created time.Time
+	expires time.Time
+}
+
+/**
+  In memory LRU cache of GET/HEAD responses for the configured routes
+*/
+type responseCache struct {
+	lock          sync.Mutex
+	routes        []cacheRoute
+	maxEntries    int
+	maxBytes      int
+	maxEntryBytes int
+	size          int
+	entries       map[string]*list.Element
+	lru           *list.List
+	//response Vary header names found per request key , dropped with the last entry of the key
+	varies map[string][]string
+	bases  map[string]int
+}
+
+func newResponseCache(config ResponseCache) (*responseCache, error) {
+	if len(config.Routes) == 0 {
+		return nil, nil
+	}
+	c := &responseCache{
+		maxEntries:    config.MaxEntries,
+		maxBytes:      config.MaxBytes,
+		maxEntryBytes: config.MaxEntryBytes,
+		entries:       map[string]*list.Element{},
+		lru:           list.New(),
+		varies:        map[string][]string{},
+		bases:         map[string]int{},
+	}
+	if c.maxEntries <= 0 {
+		c.maxEntries = defaultCacheMaxEntries
+	}
+	if c.maxBytes <= 0 {
+		c.maxBytes = defaultCacheMaxBytes
+	}
+	if c.maxEntryBytes <= 0 {
+		c.maxEntryBytes = defaultCacheMaxEntryBytes
+	}
+	for _, route := range config.Routes {
+		ttl, err := time.ParseDuration(route.TTL)
+		if err != nil {
+			return nil, err
+		}
+		vary := make([]string, 0, len(route.VaryHeaders))
+		for _, name := range route.VaryHeaders {
+			vary = append(vary, http.CanonicalHeaderKey(name))
+		}
+		c.routes = append(c.routes, cacheRoute{path: trimPathWildcard(route.Path), ttl: ttl, vary: vary})
+	}
+	return c, nil
+}
+
+//find the cache route of req , nil when req should not be cached
+func (c *responseCache) route(req *http.Request) *cacheRoute {
+	if c == nil || !isReadMethod(req.Method) {
+		return nil
+	}
+	if cacheControlHas(req.Header.Get("Cache-Control"), "no-store") {
+		return nil
+	}
+	var matched *cacheRoute
+	for i, route := range c.routes {
+		if pathUnder(req.URL.Path, route.path) && (matched == nil || len(route.path) > len(matched.path)) {
+			matched = &c.routes[i]
+		}
+	}
+	return matched
+}
+
+//write the cached response of req , return false on miss
+func (c *responseCache) serve(route *cacheRoute, resp http.ResponseWriter, req *http.Request) bool {
+	if cacheControlHas(req.Header.Get("Cache-Control"), "no-cache") {
+		return false
+	}
+	base := cacheBaseKey(req)
+	c.lock.Lock()
+	key := cacheKey(base, req, route.vary, c.varies[base])
+	element, ok := c.entries[key]
+	var entry *cacheEntry
+	if ok {
+		entry = element.Value.(*cacheEntry)
+		if time.Now().After(entry.expires) {
+			c.remove(element)
+			entry = nil
+		} else {
+			c.lru.MoveToFront(element)
+		}
+	}
+	c.lock.Unlock()
+	if entry == nil {
+		return false
+	}
+
+	header := resp.Header()
+	for name, values := range entry.header {
+		header[name] = append([]string(nil), values...)
+	}
+	header.Set("Age", strconv.Itoa(int(time.Since(entry.created).Seconds())))
+	lastModified, _ := http.ParseTime(entry.header.Get("Last-Modified"))
+	if notModified(req, entry.header.Get("ETag"), lastModified) {
+		header.Del("Content-Type")
+		header.Del("Content-Length")
+		resp.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	resp.WriteHeader(entry.status)
+	if req.Method != "HEAD" {
+		resp.Write(entry.body)
+	}
+	return true
+}
+
+//store the recorded response if it is cacheable , a body containing one of the per request values ,
+//such as the csrf token or the csp nonce , belongs to this request only and is not stored
+func (c *responseCache) store(route *cacheRoute, req *http.Request, rec *cacheRecorder, perRequest ...string) {
+	if rec.status != http.StatusOK || rec.overflow {
+		return
+	}
+	for _, value := range perRequest {
+		if value != "" && bytes.Contains(rec.body.Bytes(), []byte(value)) {
+			return
+		}
+	}
+	header := rec.handlerHeader()
+	if _, ok := header["Set-Cookie"]; ok {
+		return
+	}
+	ttl := route.ttl
+	cacheControl := header.Get("Cache-Control")
+	if cacheControlHas(cacheControl, "no-store") || cacheControlHas(cacheControl, "private") || cacheControlHas(cacheControl, "no-cache") {
+		return
+	}
+	if maxAge, ok := cacheControlMaxAge(cacheControl); ok && maxAge < ttl {
+		ttl = maxAge
+	}
+	if ttl <= 0 {
+		return
+	}
+	var vary []string
+	for _, value := range header["Vary"] {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return
+			}
+			if name != "" {
+				vary = append(vary, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+
+	base := cacheBaseKey(req)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	key := cacheKey(base, req, route.vary, vary)
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	c.varies[base] = vary
+	c.bases[base]++
+	now := time.Now()
+	entry := &cacheEntry{key: key, base: base, path: req.URL.Path, status: rec.status, header: header, body: append([]byte(nil), rec.body.Bytes()...), created: now, expires: now.Add(ttl)}
+	c.entries[key] = c.lru.PushFront(entry)
+	c.size += len(entry.body)
+	for c.lru.Len() > c.maxEntries || c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+//drop cached responses of path , a trailing * or ** drops every path under it
+func (c *responseCache) invalidate(path string) {
+	if c == nil {
+		return
+	}
+	prefix := strings.HasSuffix(path, "*")
+	path = trimPathWildcard(path)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for element := c.lru.Front(); element != nil; {
+		next := element.Next()
+		entry := element.Value.(*cacheEntry)
+		if entry.path == path || (prefix && pathUnder(entry.path, path)) {
+			c.remove(element)
+		}
+		element = next
+	}
+}
+
+func (c *responseCache) purge() {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries = map[string]*list.Element{}
+	c.varies = map[string][]string{}
+	c.bases = map[string]int{}
+	c.lru.Init()
+	c.size = 0
+}
+
+func (c *responseCache) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= len(entry.body)
+	if c.bases[entry.base]--; c.bases[entry.base] <= 0 {
+		delete(c.bases, entry.base)
+		delete(c.varies, entry.base)
+	}
+}
+
+func cacheBaseKey(req *http.Request) string {
+	return req.Method + " " + req.Host + req.URL.Path + "?" + req.URL.Query().Encode()
+}
+
+func cacheKey(base string, req *http.Request, routeVary []string, responseVary []string) string {
+	names := append(append([]string(nil), routeVary...), responseVary...)
+	sort.Strings(names)
+	key := base
+	last := ""
+	for _, name := range names {
+		if name == last {
+			continue
+		}
+		last = name
+		key += "\n" + name + ":" + strings.Join(req.Header[name], ",")
+	}
+	return key
+}
+
+func cacheControlHas(cacheControl string, directive string) bool {
+	for _, part := range strings.Split(cacheControl, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == directive || strings.HasPrefix(part, directive+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+//s-maxage wins over max-age as this is a shared cache
+func cacheControlMaxAge(cacheControl string) (time.Duration, bool) {
+	maxAge, sMaxAge := -1, -1
+	for _, part := range strings.Split(cacheControl, ",") {
+		name, value, ok := strings.Cut(strings.ToLower(strings.TrimSpace(part)), "=")
+		if !ok {
+			continue
+		}
+		seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+		if err != nil {
+			continue
+		}
+		switch name {
+		case "max-age":
+			maxAge = seconds
+		case "s-maxage":
+			sMaxAge = seconds
+		}
+	}
+	if sMaxAge >= 0 {
+		return time.Duration(sMaxAge) * time.Second, true
+	}
+	if maxAge >= 0 {
+		return time.Duration(maxAge) * time.Second, true
+	}
+	return 0, false
+}
+
+/**
+  ResponseWriter recording what the handler writes so it can be cached
+*/
+type cacheRecorder struct {
+	http.ResponseWriter
+	before   http.Header
+	status   int
+	body     bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func newCacheRecorder(resp http.ResponseWriter, limit int) *cacheRecorder {
+	return &cacheRecorder{ResponseWriter: resp, before: resp.Header().Clone(), limit: limit}
+}
+
+func (r *cacheRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *cacheRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if !r.overflow {
+		if r.body.Len()+len(b) > r.limit {
+			r.overflow = true
+			r.body.Reset()
+		} else {
+			r.body.Write(b)
+		}
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+//headers set by the handler , the ones set earlier by session and aspects belong to every request
+func (r *cacheRecorder) handlerHeader() http.Header {
+	header := http.Header{}
+	for name, values := range r.ResponseWriter.Header() {
+		if before, ok := r.before[name]; ok && strings.Join(before, "\n") == strings.Join(values, "\n") {
+			continue
+		}
+		header[name] = append([]string(nil), values...)
+	}
+	return header
+}
@@ -0,0 +1,94 @@
+package wserver
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCacheControlMaxAge(t *testing.T) {
+	cases := []struct {
+		header string
+		age    time.Duration
+		found  bool
+	}{
+		{"", 0, false},
+		{"public, max-age=60", time.Minute, true},
+		{"max-age=60, s-maxage=10", 10 * time.Second, true},
+		{"max-age=0", 0, true},
+	}
+	for _, c := range cases {
+		age, found := cacheControlMaxAge(c.header)
+		if age != c.age || found != c.found {
+			t.Errorf("cacheControlMaxAge(%q) = %v %v", c.header, age, found)
+		}
+	}
+}
+
+func TestResponseCacheEviction(t *testing.T) {
+	cache, err := newResponseCache(ResponseCache{MaxEntries: 2, Routes: []CacheRoute{{Path: "/**", TTL: "1m"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := func(path string) {
+		req := httptest.NewRequest("GET", path, nil)
+		rec := newCacheRecorder(httptest.NewRecorder(), cache.maxEntryBytes)
+		rec.Write([]byte(path))
+		cache.store(cache.route(req), req, rec)
+	}
+	hit := func(path string) bool {
+		req := httptest.NewRequest("GET", path, nil)
+		return cache.serve(cache.route(req), httptest.NewRecorder(), req)
+	}
+	record("/a")
+	record("/b")
+	if !hit("/a") {
+		t.Fatal("expected /a to be cached")
+	}
+	record("/c")
+	if hit("/b") {
+		t.Error("least recently used /b should be evicted")
+	}
+	if !hit("/a") || !hit("/c") {
+		t.Error("expected /a and /c to stay cached")
+	}
+	cache.invalidate("/a")
+	if hit("/a") {
+		t.Error("/a should be invalidated")
+	}
+}
+
+func TestResponseCacheKeys(t *testing.T) {
+	cache, err := newResponseCache(ResponseCache{MaxEntries: 2, Routes: []CacheRoute{{Path: "/**", TTL: "1m"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := func(target string, body string, perRequest ...string) {
+		req := httptest.NewRequest("GET", target, nil)
+		rec := newCacheRecorder(httptest.NewRecorder(), cache.maxEntryBytes)
+		rec.Header().Set("Vary", "Accept-Language")
+		rec.Write([]byte(body))
+		cache.store(cache.route(req), req, rec, perRequest...)
+	}
+	hit := func(target string) bool {
+		req := httptest.NewRequest("GET", target, nil)
+		return cache.serve(cache.route(req), httptest.NewRecorder(), req)
+	}
+
+	for i := 0; i < 10; i++ {
+		record("/search?q="+string(rune('a'+i)), "result")
+	}
+	if len(cache.varies) != 2 || len(cache.bases) != 2 {
+		t.Errorf("vary names of evicted entries should be dropped, got %d %d", len(cache.varies), len(cache.bases))
+	}
+
+	record("http://a.example/page", "a")
+	if hit("http://b.example/page") {
+		t.Error("responses of another host should not be served")
+	}
+	record("/form", `<input name="csrf_token" value="t0k3n">`, "t0k3n", "")
+	record("/script", `<script nonce="n0nc3">`, "", "n0nc3")
+	if hit("/form") || hit("/script") {
+		t.Error("responses embedding the csrf token or the csp nonce should not be stored")
+	}
+}
@@ -0,0 +1,28 @@
+package wserver
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+//env var carrying the pipe a hot restarted child writes to once it is ready
+const readyFdEnv = "WSERVER_READY_FD"
+
+const defaultHotRestartTimeout = 30 * time.Second
+
+//tell the parent of a hot restart that this process serves , the parent drains afterwards
+func notifyParentReady() {
+	value := os.Getenv(readyFdEnv)
+	if value == "" {
+		return
+	}
+	os.Unsetenv(readyFdEnv)
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return
+	}
+	f := os.NewFile(uintptr(fd), "ready")
+	f.Write([]byte{1})
+	f.Close()
+}
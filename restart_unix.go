@@ -0,0 +1,143 @@
+//go:build !windows
+// +build !windows
+
+package wserver
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/fitmewell/wserver/log"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type fileListener interface {
+	File() (*os.File, error)
+}
+
+//start the new binary with the listening sockets , wait until it serves and drain this process
+func (ws *Server) hotRestart() error {
+	if !ws.config.HotRestart.Enable {
+		return errors.New("hot restart is not enabled")
+	}
+	if ws.stopping.Load() {
+		return errors.New("server is stopping")
+	}
+	if !ws.restarting.CompareAndSwap(false, true) {
+		return errors.New("hot restart already running")
+	}
+	handedOver := false
+	defer func() {
+		if !handedOver {
+			ws.restarting.Store(false)
+		}
+	}()
+
+	timeout := defaultHotRestartTimeout
+	if value := ws.config.HotRestart.ReadyTimeout; value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		timeout = d
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	ws.serversLock.Lock()
+	listeners := append([]serverListener(nil), ws.listeners...)
+	ws.serversLock.Unlock()
+	var files []*os.File
+	var names []string
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, l := range listeners {
+		fl, ok := l.listener.(fileListener)
+		if !ok {
+			return errors.New("listener " + l.name + " can not be passed to a child process")
+		}
+		f, err := fl.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+		names = append(names, l.name)
+	}
+
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer ready.Close()
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = append(files, readyWriter)
+	cmd.Env = restartEnv(os.Environ(), names, listenFdsStart+len(files))
+	err = cmd.Start()
+	readyWriter.Close()
+	if err != nil {
+		return err
+	}
+	//Release resets Process.Pid , keep it for the messages
+	pid := cmd.Process.Pid
+	DebugF("hot restart: started child %d", pid)
+
+	signaled := make(chan error, 1)
+	go func() {
+		b := make([]byte, 1)
+		_, err := ready.Read(b)
+		signaled <- err
+	}()
+	select {
+	case err = <-signaled:
+	case <-time.After(timeout):
+		err = errors.New("no ready signal within " + timeout.String())
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		go cmd.Wait()
+		return fmt.Errorf("hot restart: child %d not ready: %v", pid, err)
+	}
+	go cmd.Process.Release()
+
+	DebugF("hot restart: child %d ready , draining", pid)
+	//the child serves the unix socket files now , keep them when closing
+	for _, l := range listeners {
+		if ul, ok := l.listener.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+	//still restarting while draining , another child would be started on the same sockets
+	handedOver = true
+	go func() {
+		ws.stopWithin(ws.config.Shutdown.Timeout)
+		ws.restarting.Store(false)
+	}()
+	return nil
+}
+
+//environment of the child , the activation variables inherited from systemd are replaced ,
+//without LISTEN_PID the child takes the sockets as its own
+func restartEnv(environ []string, names []string, readyFd int) []string {
+	env := make([]string, 0, len(environ)+3)
+	for _, kv := range environ {
+		if strings.HasPrefix(kv, "LISTEN_") || strings.HasPrefix(kv, readyFdEnv+"=") {
+			continue
+		}
+		env = append(env, kv)
+	}
+	return append(env,
+		"LISTEN_FDS="+strconv.Itoa(len(names)),
+		"LISTEN_FDNAMES="+strings.Join(names, ":"),
+		readyFdEnv+"="+strconv.Itoa(readyFd),
+	)
+}
@@ -0,0 +1,104 @@
+//go:build !windows
+// +build !windows
+
+package wserver
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+//set for the child started by TestHotRestart , the test binary then serves instead of running the tests
+const restartChildEnv = "WSERVER_TEST_RESTART_CHILD"
+
+//generous bound of every wait of TestHotRestart , a loaded ci machine may take seconds to start the child
+const restartTestTimeout = 60 * time.Second
+
+func TestMain(m *testing.M) {
+	if os.Getenv(restartChildEnv) != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), restartTestTimeout)
+		defer cancel()
+		//one answer is all the parent checks , the stop drains it
+		s := newRestartTestServer("child", cancel)
+		if err := s.Start(ctx); err != nil {
+			os.Stderr.WriteString(err.Error() + "\n")
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func newRestartTestServer(name string, served func()) *Server {
+	s := NewServer(&ServerConfig{
+		Listeners:  []Listener{{Name: "web", Address: "127.0.0.1:0"}},
+		HotRestart: HotRestart{Enable: true, ReadyTimeout: restartTestTimeout.String()},
+	}).DisableSignals()
+	s.AddHandler("GET", "/", func() []byte {
+		served()
+		return []byte(name)
+	})
+	return s
+}
+
+func TestRestartEnv(t *testing.T) {
+	env := restartEnv([]string{"HOME=/root", "LISTEN_PID=1", "LISTEN_FDS=2", "LISTEN_FDNAMES=a:b", readyFdEnv + "=9"}, []string{"web", "admin"}, 5)
+	expected := "HOME=/root LISTEN_FDS=2 LISTEN_FDNAMES=web:admin " + readyFdEnv + "=5"
+	if got := strings.Join(env, " "); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestHotRestart(t *testing.T) {
+	if err := NewPortServer("0").Restart(); err == nil {
+		t.Error("restart should need HotRestart.Enable")
+	}
+	//left by systemd for the parent , the child must not take it as a mismatch
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv(restartChildEnv, "1")
+	s := newRestartTestServer("parent", func() {})
+	served := make(chan error, 1)
+	go func() { served <- s.Start(context.Background()) }()
+	select {
+	case <-s.Ready():
+	case <-time.After(restartTestTimeout):
+		t.Fatal("parent not ready")
+	}
+	url := "http://" + s.listeners[0].listener.Addr().String() + "/"
+	get := func() string {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return string(body)
+	}
+	if body := get(); body != "parent" {
+		t.Fatalf("expected the parent to serve, got %q", body)
+	}
+	if err := s.Restart(); err != nil {
+		t.Fatalf("child not ready within %v: %v", restartTestTimeout, err)
+	}
+	//this process drains now , a second child must not be started on the same sockets
+	if err := s.Restart(); err == nil {
+		t.Error("restart while draining should fail")
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("parent should drain cleanly, got %v", err)
+		}
+	case <-time.After(restartTestTimeout):
+		t.Fatal("parent not stopped after the child got ready")
+	}
+	http.DefaultClient.CloseIdleConnections()
+	if body := get(); body != "child" {
+		t.Errorf("expected the child to serve on the same socket, got %q", body)
+	}
+}
@@ -0,0 +1,7 @@
+package wserver
+
+import "errors"
+
+func (ws *Server) hotRestart() error {
+	return errors.New("hot restart is not supported on windows")
+}
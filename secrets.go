@@ -0,0 +1,118 @@
+package wserver
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+/**
+  Source of secret values , a value "secret:<scheme>:<name>" in Database.Username , Database.Password or
+  a property is replaced by the secret name of the provider added for scheme , other values are kept ,
+  the database credentials also take the built-in "file:<path>" and "env:<name>" without the marker
+*/
+type SecretProvider interface {
+	//the secret called name , an error aborts the server start
+	Secret(name string) (string, error)
+}
+
+//adapt a function to SecretProvider
+type SecretProviderFunc func(name string) (string, error)
+
+func (f SecretProviderFunc) Secret(name string) (string, error) {
+	return f(name)
+}
+
+//marker of the values referencing a secret , plain values such as file:report.csv stay as they are
+const secretPrefix = "secret:"
+
+//secret:file:/run/secrets/db reads the file , without its trailing line break
+var fileSecrets = SecretProviderFunc(func(name string) (string, error) {
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+})
+
+//secret:env:DB_PASS reads the environment variable
+var envSecrets = SecretProviderFunc(func(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", errors.New("environment variable " + name + " is not set")
+	}
+	return value, nil
+})
+
+type secretResolver struct {
+	lock      sync.RWMutex
+	providers map[string]SecretProvider
+}
+
+func newSecretResolver() *secretResolver {
+	return &secretResolver{providers: map[string]SecretProvider{"file": fileSecrets, "env": envSecrets}}
+}
+
+func (s *secretResolver) add(scheme string, provider SecretProvider) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.providers[scheme] = provider
+}
+
+//the secret value references , value itself when it does not start with secret:
+func (s *secretResolver) resolve(value string) (string, error) {
+	reference, ok := strings.CutPrefix(value, secretPrefix)
+	if !ok {
+		return value, nil
+	}
+	scheme, name, _ := strings.Cut(reference, ":")
+	s.lock.RLock()
+	provider := s.providers[scheme]
+	s.lock.RUnlock()
+	if provider == nil {
+		return "", errors.New("secret " + value + ": no provider for " + scheme)
+	}
+	secret, err := provider.Secret(name)
+	if err != nil {
+		//the reference is no secret , the error may still be shown
+		return "", errors.New("secret " + value + ": " + err.Error())
+	}
+	return secret, nil
+}
+
+//like resolve , but file: and env: references need no secret: marker , a database password rarely starts with them
+func (s *secretResolver) resolveCredential(value string) (string, error) {
+	if scheme, _, _ := strings.Cut(value, ":"); scheme == "file" || scheme == "env" {
+		return s.resolve(secretPrefix + value)
+	}
+	return s.resolve(value)
+}
+
+//resolve every property value in place
+func (s *secretResolver) resolveProperties(properties map[string]string) error {
+	var errs []error
+	for key, value := range properties {
+		resolved, err := s.resolve(value)
+		if err != nil {
+			errs = append(errs, errors.New("property "+key+": "+err.Error()))
+			continue
+		}
+		properties[key] = resolved
+	}
+	return errors.Join(errs...)
+}
+
+var sensitiveKeyParts = []string{"password", "passwd", "secret", "token", "credential", "apikey", "api_key", "private"}
+
+//value of a property as it may be logged , masked when the key looks like it holds a secret
+func loggedProperty(key string, value string) string {
+	key = strings.ToLower(key)
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(key, part) {
+			return "******"
+		}
+	}
+	return value
+}
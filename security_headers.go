@@ -0,0 +1,92 @@
+package wserver
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//key of the per request CSP nonce in ServletContext data , use {{.CSPNonce}} in templates
+const CSPNonceKey = "CSPNonce"
+
+const (
+	defaultHSTSMaxAge     = 31536000
+	defaultFrameOptions   = "DENY"
+	defaultReferrerPolicy = "strict-origin-when-cross-origin"
+)
+
+/**
+  Aspect writing the configured security headers before the handler runs
+*/
+type securityHeaderAspect struct {
+	config SecurityHeaders
+	hsts   string
+}
+
+func newSecurityHeaderAspect(config SecurityHeaders) *securityHeaderAspect {
+	maxAge := config.HSTSMaxAge
+	if maxAge <= 0 {
+		maxAge = defaultHSTSMaxAge
+	}
+	hsts := "max-age=" + strconv.Itoa(maxAge)
+	if config.HSTSIncludeSubDomains {
+		hsts += "; includeSubDomains"
+	}
+	if config.HSTSPreload {
+		hsts += "; preload"
+	}
+	if config.FrameOptions == "" {
+		config.FrameOptions = defaultFrameOptions
+	}
+	if config.ReferrerPolicy == "" {
+		config.ReferrerPolicy = defaultReferrerPolicy
+	}
+	return &securityHeaderAspect{config: config, hsts: hsts}
+}
+
+func (s *securityHeaderAspect) ShouldAppendOn(req *http.Request) bool {
+	return true
+}
+
+func (s *securityHeaderAspect) BeforeOrAfter() bool {
+	return true
+}
+
+func (s *securityHeaderAspect) Server(context ServletContext, resp http.ResponseWriter, req *http.Request) bool {
+	header := resp.Header()
+	//the scheme is https as well behind a trusted tls terminating proxy
+	if context.GetScheme() == "https" {
+		header.Set("Strict-Transport-Security", s.hsts)
+	}
+	if policy := s.config.ContentSecurityPolicy; policy != "" {
+		if strings.Contains(policy, "{nonce}") {
+			nonce, err := newNonce()
+			if err != nil {
+				http.Error(resp, STATUS_INTERNAL_SERVER_ERROR.statusMessage, STATUS_INTERNAL_SERVER_ERROR.statusCode)
+				return false
+			}
+			context.SetData(CSPNonceKey, nonce)
+			policy = strings.Replace(policy, "{nonce}", "'nonce-"+nonce+"'", -1)
+		}
+		header.Set("Content-Security-Policy", policy)
+	}
+	if !s.config.DisableNoSniff {
+		header.Set("X-Content-Type-Options", "nosniff")
+	}
+	header.Set("X-Frame-Options", s.config.FrameOptions)
+	header.Set("Referrer-Policy", s.config.ReferrerPolicy)
+	if s.config.PermissionsPolicy != "" {
+		header.Set("Permissions-Policy", s.config.PermissionsPolicy)
+	}
+	return true
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,71 @@
+package wserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	cases := []struct {
+		config   SecurityHeaders
+		expected map[string]string
+	}{
+		{SecurityHeaders{Enable: true}, map[string]string{
+			"X-Content-Type-Options":  "nosniff",
+			"X-Frame-Options":         "DENY",
+			"Referrer-Policy":         "strict-origin-when-cross-origin",
+			"Permissions-Policy":      "",
+			"Content-Security-Policy": "",
+		}},
+		{SecurityHeaders{Enable: true, DisableNoSniff: true, FrameOptions: "SAMEORIGIN", ReferrerPolicy: "no-referrer",
+			PermissionsPolicy: "camera=()", ContentSecurityPolicy: "default-src 'self'"}, map[string]string{
+			"X-Content-Type-Options":  "",
+			"X-Frame-Options":         "SAMEORIGIN",
+			"Referrer-Policy":         "no-referrer",
+			"Permissions-Policy":      "camera=()",
+			"Content-Security-Policy": "default-src 'self'",
+		}},
+	}
+	for _, c := range cases {
+		s := NewServer(&ServerConfig{SecurityHeaders: c.config})
+		s.AddHandler("GET", "/", func() []byte { return []byte("ok") })
+		initTestHandler(t, s)
+		rec := httptest.NewRecorder()
+		s.handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		for name, value := range c.expected {
+			if got := rec.Header().Get(name); got != value {
+				t.Errorf("%+v: expected %s %q, got %q", c.config, name, value, got)
+			}
+		}
+	}
+}
+
+func TestCSPNonce(t *testing.T) {
+	s := NewServer(&ServerConfig{SecurityHeaders: SecurityHeaders{Enable: true,
+		ContentSecurityPolicy: "script-src 'self' {nonce}; style-src {nonce}"}})
+	s.AddHandler("GET", "/", func(c ServletContext) []byte {
+		nonce, _ := c.GetData()[CSPNonceKey].(string)
+		return []byte(nonce)
+	})
+	initTestHandler(t, s)
+	get := func() (string, string) {
+		rec := httptest.NewRecorder()
+		s.handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("unexpected status %d", rec.Code)
+		}
+		return rec.Body.String(), rec.Header().Get("Content-Security-Policy")
+	}
+
+	nonce, policy := get()
+	if nonce == "" {
+		t.Fatal("nonce not exposed in the servlet context data")
+	}
+	if expected := "script-src 'self' 'nonce-" + nonce + "'; style-src 'nonce-" + nonce + "'"; policy != expected {
+		t.Errorf("expected policy %q, got %q", expected, policy)
+	}
+	if next, _ := get(); next == nonce {
+		t.Error("nonce reused across requests")
+	}
+}
@@ -1,24 +1,48 @@
 package wserver
 
 import (
+	"context"
 	"errors"
 	. "github.com/fitmewell/wserver/log"
 	"github.com/fitmewell/wserver/wsession"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
+//returned by Start and Serve once Stop was called , a stopped server can not be started again
+var ErrServerStopped = errors.New("Server stopped")
+
 func New(filePath string) (wServer *Server, err error) {
+	return NewProfile(filePath, "")
+}
+
+//like New with the overlay of profile , see NewProfileConfig
+func NewProfile(filePath string, profile string) (wServer *Server, err error) {
 	Debug("loading config file: " + filePath)
-	config, err := NewConfig(filePath)
+	config, err := NewProfileConfig(filePath, profile)
 	if err != nil {
 		return nil, err
 	}
-	return NewServer(config), nil
+	return newConfigServer(filePath, config)
+}
+
+//validate config loaded from filePath and create the server , Reload reads filePath again
+func newConfigServer(filePath string, config *ServerConfig) (*Server, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	server := NewServer(config)
+	if serverContext, ok := server.context.(*DefaultServerContext); ok && serverContext.loadErr != nil {
+		return nil, serverContext.loadErr
+	}
+	server.configPath = filePath
+	return server, nil
 }
 
 func NewPortServer(port string) (wServer *Server) {
@@ -26,14 +50,21 @@ func NewPortServer(port string) (wServer *Server) {
 	return NewServer(config)
 }
 
+//create the server , config problems are logged here and returned by Start and Serve
 func NewServer(config *ServerConfig) *Server {
+	if err := config.Validate(); err != nil {
+		Debug("invalid config: " + err.Error())
+	}
 	server := &Server{
 		config:         config,
 		sessionManager: wsession.NewDefaultSessionManager(config.Session.CookieName),
-		aftermaths:     map[string]func(){},
+		ready:          make(chan struct{}),
+		stopped:        make(chan struct{}),
 	}
 	server.handler = newDefaultHandler(server)
-	server.context = NewContextFrom(server.config)
+	serverContext := NewContextFrom(server.config)
+	server.secrets = serverContext.secrets
+	server.context = serverContext
 	return server
 }
 
@@ -44,97 +75,277 @@ type Server struct {
 	lock           sync.Mutex
 	started        bool
 	sessionManager wsession.SessionManager
-	aftermaths     map[string]func()
+	aftermaths     []aftermath
+	hooks          []lifecycleHook
+	healthChecks   []healthCheck
+	httpServers    []*http.Server
+	//guards httpServers and listeners
+	serversLock    sync.Mutex
+	ready          chan struct{}
+	readyClosed    bool
+	serving        atomic.Bool
+	stopped        chan struct{}
+	stopOnce       sync.Once
+	stopErr        error
+	stopping       atomic.Bool
+	listeners      []serverListener
+	certStores     []*certStore
+	configPath     string
+	reloadLock     sync.Mutex
+	templatesPrint string
+	secrets        *secretResolver
+	restarting     atomic.Bool
+	//properties set by SetProperty , they win over the loaded ones on every reload
+	overrides map[string]string
+	//added by AddTemplate and AddStaticSource , appended to the lists of the config file on every reload
+	addedTemplates       []Template
+	addedStaticResources []StaticResource
 }
 
-func (ws *Server) Start() {
+//bind the configured ports and serve until ctx is done , Stop is called or a listener fails ,
+//return nil once the server stopped cleanly
+func (ws *Server) Start(ctx context.Context) error {
+	if err := ws.prepare(); err != nil {
+		ws.closeReady()
+		return err
+	}
+	listeners, err := ws.bind()
+	if err != nil {
+		ws.unprepare()
+		ws.closeReady()
+		return err
+	}
+	return ws.run(ctx, listeners)
+}
 
-	ws.lock.Lock()
-	defer func() {
-		ws.started = false
+//serve on l until Stop is called , the SSL settings are not used but HTTP2.H2C is
+func (ws *Server) Serve(l net.Listener) error {
+	if err := ws.prepare(); err != nil {
+		ws.closeReady()
+		return err
+	}
+	s := ws.newHttpServer(l.Addr().String(), ws.handler)
+	if err := ws.configureHTTP2(s, false); err != nil {
+		ws.unprepare()
+		ws.closeReady()
+		return err
+	}
+	return ws.run(context.Background(), []serverListener{{server: s, listener: l}})
+}
+
+//stop accepting , drain in-flight requests until ctx is done , run aftermaths and close db pools
+func (ws *Server) Stop(ctx context.Context) error {
+	ws.stopping.Store(true)
+	ws.stopOnce.Do(func() {
+		Debug("closing")
+		ws.stopErr = ws.shutdown(ctx)
 		Debug("end")
-		ws.lock.Unlock()
-	}()
+		close(ws.stopped)
+	})
+	<-ws.stopped
+	return ws.stopErr
+}
+
+//closed once the server is listening , or once Start or Serve failed and returned the error ,
+//a retried Start gets a new channel
+func (ws *Server) Ready() <-chan struct{} {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	return ws.ready
+}
+
+func (ws *Server) closeReady() {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	if !ws.readyClosed {
+		ws.readyClosed = true
+		close(ws.ready)
+	}
+}
+
+//serving and not shutting down
+func (ws *Server) isServing() bool {
+	return ws.serving.Load() && !ws.stopping.Load()
+}
 
+//start the new binary on the same sockets and drain this server once it is ready ,
+//needs HotRestart.Enable and is triggered by SIGUSR2 as well
+func (ws *Server) Restart() error {
+	return ws.hotRestart()
+}
+
+//do not install the signal handlers , for servers embedded in libraries and tests
+func (ws *Server) DisableSignals() *Server {
+	ws.config.DisableSignals = true
+	return ws
+}
+
+func (ws *Server) prepare() error {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
 	if ws.started {
-		Fatal("Server already started")
+		return errors.New("Server already started")
+	}
+	select {
+	case <-ws.stopped:
+		//stopped before it was started , the listeners would never be shut down
+		return ErrServerStopped
+	default:
+	}
+	if ws.readyClosed {
+		//closed by a failed start
+		ws.ready = make(chan struct{})
+		ws.readyClosed = false
+	}
+	//a failed attempt may have left servers and certificates behind , they would be shut down or reloaded again
+	ws.serversLock.Lock()
+	ws.httpServers = nil
+	ws.listeners = nil
+	ws.certStores = nil
+	ws.serversLock.Unlock()
+	//also catches servers built by NewServer and changed by AddStaticSource , AddTemplate ...
+	if err := ws.config.Validate(); err != nil {
+		return err
+	}
+	//the level is process wide , so it follows the server being started rather than the last one built
+	applyLogLevel(ws.config.LogLevel)
+	err := openContext(ws.context)
+	if err == nil {
+		err = ws.runHooks(phaseInit, false)
+	}
+	if err == nil {
+		err = ws.handler.init()
+	}
+	if err == nil {
+		err = ws.runHooks(phaseStart, false)
+	}
+	if err != nil {
+		//not started , Start may be called again once the problem is fixed
+		closeContext(ws.context)
+		return err
 	}
 	ws.started = true
-	ws.context.Init()
-	ws.handler.init()
-	Debug("started")
-	ws.aftermath()
-	ws.listen()
-}
-
-func (ws *Server) listen() {
-
-	var err error
-	config := ws.config
-	if config.UseSSL {
-		go func() {
-			httpServerMux := http.NewServeMux()
-			httpServerMux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-				http.Redirect(w, r, "https:"+r.Host+":443"+r.RequestURI, http.StatusMovedPermanently)
-			})
-			s := &http.Server{Addr: ":" + config.Port, Handler: httpServerMux}
-			if err := s.ListenAndServe(); err != nil {
-				FatalF("ListenAndServe error: %v", err)
+	return nil
+}
+
+//undo prepare when the ports can not be bound
+func (ws *Server) unprepare() {
+	closeContext(ws.context)
+	ws.lock.Lock()
+	ws.started = false
+	ws.lock.Unlock()
+}
+
+func (ws *Server) run(ctx context.Context, listeners []serverListener) error {
+	if !ws.config.DisableSignals {
+		ws.aftermath()
+	}
+	ws.serversLock.Lock()
+	ws.listeners = listeners
+	ws.serversLock.Unlock()
+	if err := ws.watchCertificates(); err != nil {
+		ws.stopWithin(ws.config.Shutdown.Timeout)
+		ws.closeReady()
+		return err
+	}
+	if err := ws.watchConfig(); err != nil {
+		ws.stopWithin(ws.config.Shutdown.Timeout)
+		ws.closeReady()
+		return err
+	}
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l serverListener) {
+			DebugF("listening on %s", l.listener.Addr())
+			if l.tls {
+				//certificates come from the server TLSConfig
+				errs <- l.server.ServeTLS(l.listener, "", "")
+			} else {
+				errs <- l.server.Serve(l.listener)
 			}
-		}()
-		s := &http.Server{Addr: ":" + config.SSLConfig.SSLPort, Handler: ws.handler}
-		err = s.ListenAndServeTLS(config.SSLConfig.CertFile, config.SSLConfig.KeyFile)
-	} else {
-		s := &http.Server{Addr: ":" + config.Port, Handler: ws.handler}
-		err = s.ListenAndServe()
+		}(l)
 	}
-	if err != nil {
-		Debug(err)
+	if err := ws.runHooks(phaseReady, false); err != nil {
+		ws.stopWithin(ws.config.Shutdown.Timeout)
+		ws.closeReady()
+		return err
 	}
+	Debug("started")
+	ws.serving.Store(true)
+	ws.closeReady()
+	notifyParentReady()
+
+	select {
+	case <-ctx.Done():
+		ws.stopWithin(ws.config.Shutdown.Timeout)
+	case err := <-errs:
+		if err != http.ErrServerClosed {
+			Debug(err)
+			ws.stopWithin(ws.config.Shutdown.Timeout)
+			return err
+		}
+	case <-ws.stopped:
+	}
+	<-ws.stopped
+	return ws.stopErr
+}
+
+//stop with the configured drain timeout
+func (ws *Server) stopWithin(timeout string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), parseShutdownTimeout(timeout))
+	defer cancel()
+	return ws.Stop(ctx)
+}
+
+//create a http server which is drained on shutdown
+func (ws *Server) newHttpServer(addr string, handler http.Handler) *http.Server {
+	s := &http.Server{Addr: addr, Handler: handler}
+	ws.serversLock.Lock()
+	ws.httpServers = append(ws.httpServers, s)
+	ws.serversLock.Unlock()
+	return s
 }
 
 func (ws *Server) aftermath() {
 	s := make(chan os.Signal, 2)
 	signal.Notify(s)
 	go func() {
+		defer signal.Stop(s)
+		shuttingDown := false
 		for {
-			cs := <-s
+			var cs os.Signal
+			select {
+			case cs = <-s:
+			case <-ws.stopped:
+				return
+			}
 			Debug("caught system signal:" + cs.String())
 			switch cs {
+			case maintenanceSignal:
+				ws.SetMaintenance(!ws.InMaintenance())
+			case reloadSignal:
+				go func() {
+					if err := ws.Reload(); err != nil {
+						Debug(err)
+					}
+				}()
+			case restartSignal:
+				go func() {
+					if err := ws.hotRestart(); err != nil {
+						Debug(err)
+					}
+				}()
 			case os.Interrupt:
 				fallthrough
 			case syscall.SIGTERM:
 				fallthrough
 			case os.Kill:
-				Debug("closing")
-				ws.started = false
-
-				go func() {
-					time.Sleep(5 * time.Second)
-					Debug("end")
-					ws.lock.Unlock()
+				if shuttingDown {
+					Debug("forced exit")
 					os.Exit(1)
-				}()
-				c := make(chan string, len(ws.aftermaths))
-				for k, v := range ws.aftermaths {
-					go func(name string, method func()) {
-						Debug("[aftermath][" + name + "]start")
-						method()
-						c <- name
-					}(k, v)
-				}
-
-				amount := 0
-				for {
-					k := <-c
-					Debug("[aftermath][" + k + "]end")
-					amount++
-					if amount == len(ws.aftermaths) {
-						Debug("end")
-						ws.lock.Unlock()
-						os.Exit(1)
-					}
 				}
+				shuttingDown = true
+				go ws.stopWithin(ws.config.Shutdown.Timeout)
 			}
 		}
 	}()
@@ -150,12 +361,76 @@ func (ws *Server) AddHandler(method string, path string, e interface{}) *Server
 }
 
 func (ws *Server) AddStaticSource(path, fileLocate string) *Server {
-	ws.config.StaticResources = append(ws.config.StaticResources, StaticResource{Path: path, FileLocate: fileLocate})
+	resource := StaticResource{Path: path, FileLocate: fileLocate}
+	ws.lock.Lock()
+	ws.config.StaticResources = append(ws.config.StaticResources, resource)
+	ws.addedStaticResources = append(ws.addedStaticResources, resource)
+	ws.lock.Unlock()
 	return ws
 }
 
 func (ws *Server) AddTemplate(name, dir string) *Server {
-	ws.config.Templates = append(ws.config.Templates, Template{Name: name, Dir: dir})
+	template := Template{Name: name, Dir: dir}
+	ws.lock.Lock()
+	ws.config.Templates = append(ws.config.Templates, template)
+	ws.addedTemplates = append(ws.addedTemplates, template)
+	ws.lock.Unlock()
+	return ws
+}
+
+//set a deadline for requests under path , see Timeout
+func (ws *Server) AddTimeout(path string, timeout time.Duration) *Server {
+	ws.config.Timeout.Routes = append(ws.config.Timeout.Routes, RouteTimeout{Path: path, Timeout: timeout.String()})
+	return ws
+}
+
+//cache GET responses under path for ttl , vary lists request headers that change the response
+func (ws *Server) AddCacheRoute(path string, ttl time.Duration, vary ...string) *Server {
+	ws.config.ResponseCache.Routes = append(ws.config.ResponseCache.Routes, CacheRoute{Path: path, TTL: ttl.String(), VaryHeaders: vary})
+	return ws
+}
+
+//drop cached responses of path , a trailing * or ** drops every path under it
+func (ws *Server) InvalidateCache(path string) {
+	ws.handler.cache.invalidate(path)
+}
+
+//drop every cached response
+func (ws *Server) PurgeCache() {
+	ws.handler.cache.purge()
+}
+
+//switch maintenance mode on or off at runtime , no paths means the whole server
+func (ws *Server) SetMaintenance(enabled bool, paths ...string) *Server {
+	ws.handler.maintenance.set(enabled, paths...)
+	if enabled {
+		Debug("maintenance on ", paths)
+	} else {
+		Debug("maintenance off")
+	}
+	return ws
+}
+
+func (ws *Server) InMaintenance() bool {
+	return ws.handler.maintenance.isEnabled()
+}
+
+//add ip allow/deny rule for requests under path
+func (ws *Server) AddAccessRule(path string, allow []string, deny []string) *Server {
+	ws.config.AccessRules = append(ws.config.AccessRules, AccessRule{Path: path, Allow: allow, Deny: deny})
+	return ws
+}
+
+//skip csrf check for requests under path , such as webhooks
+func (ws *Server) ExcludeCsrf(path string) *Server {
+	ws.config.Csrf.ExcludePaths = append(ws.config.Csrf.ExcludePaths, path)
+	return ws
+}
+
+//resolve values "secret:<scheme>:<name>" of Database.Username , Database.Password and properties with
+//provider , file and env are built in and the database credentials take them without secret:
+func (ws *Server) AddSecretProvider(scheme string, provider SecretProvider) *Server {
+	ws.secrets.add(scheme, provider)
 	return ws
 }
 
@@ -164,14 +439,44 @@ func (ws *Server) AddAspectHandler(handler AspectHandler) *Server {
 	return ws
 }
 
+//add method run on shutdown after in-flight requests are drained , aftermaths run one by one in the order
+//they are added and each gets Shutdown.AftermathTimeout to finish
 func (ws *Server) AddAftermath(name string, method func()) error {
-	if _, ok := ws.aftermaths[name]; ok {
-		return errors.New("duplicate aftermatch found")
+	return ws.AddAftermathTimeout(name, 0, method)
+}
+
+//add aftermath with its own deadline , zero uses Shutdown.AftermathTimeout
+func (ws *Server) AddAftermathTimeout(name string, timeout time.Duration, method func()) error {
+	for _, a := range ws.aftermaths {
+		if a.name == name {
+			return errors.New("duplicate aftermatch found")
+		}
 	}
-	ws.aftermaths[name] = method
+	ws.aftermaths = append(ws.aftermaths, aftermath{name: name, timeout: timeout, method: method})
 	return nil
 }
 
+//set property key , it wins over the config and the properties files and is kept by Reload
+func (ws *Server) SetProperty(key, value string) *Server {
+	ws.lock.Lock()
+	if ws.overrides == nil {
+		ws.overrides = map[string]string{}
+	}
+	ws.overrides[key] = value
+	ws.lock.Unlock()
+	if serverContext, ok := ws.context.(*DefaultServerContext); ok {
+		serverContext.lock.Lock()
+		serverContext.properties[key] = value
+		serverContext.lock.Unlock()
+	}
+	return ws
+}
+
 func (ws *Server) GetProperties(i string) string {
 	return ws.context.GetProperty(i)
 }
+
+//fill the struct target points to from the properties under prefix , see ConfigContext.BindProperties
+func (ws *Server) BindProperties(prefix string, target interface{}) error {
+	return configContext(ws.context).BindProperties(prefix, target)
+}
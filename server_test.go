@@ -0,0 +1,544 @@
+package wserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	wlog "github.com/fitmewell/wserver/log"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeAndStop(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(&ServerConfig{}).DisableSignals()
+	s.AddHandler("GET", "/hello", func() []byte {
+		time.Sleep(100 * time.Millisecond)
+		return []byte("hello")
+	})
+	ran := false
+	s.AddAftermath("mark", func() { ran = true })
+
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(l) }()
+	select {
+	case <-s.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("server not ready")
+	}
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + l.Addr().String() + "/hello")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+	time.Sleep(30 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if b := <-body; b != "hello" {
+		t.Errorf("in-flight request not drained: %q", b)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Serve returned %v", err)
+	}
+	if !ran {
+		t.Error("aftermath not run")
+	}
+	if err := s.Serve(l); err == nil {
+		t.Error("second start should fail")
+	}
+}
+
+func TestStopBeforeServe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s := NewServer(&ServerConfig{Port: "0"}).DisableSignals()
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Serve(l); err != ErrServerStopped {
+		t.Errorf("Serve after Stop should fail with ErrServerStopped, got %v", err)
+	}
+	if err := s.Start(context.Background()); err != ErrServerStopped {
+		t.Errorf("Start after Stop should fail with ErrServerStopped, got %v", err)
+	}
+	select {
+	case <-s.Ready():
+	default:
+		t.Error("Ready not closed by the failed start")
+	}
+	if s.isServing() {
+		t.Error("stopped server serving")
+	}
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	mark := func(name string) func(ConfigContext) error {
+		return func(ConfigContext) error {
+			order = append(order, name)
+			return nil
+		}
+	}
+	s := NewServer(&ServerConfig{}).DisableSignals()
+	s.OnStop("stop", mark("stop")).OnReady("ready", mark("ready")).OnStart("start", mark("start")).OnInit("init", mark("init"))
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(l) }()
+	<-s.Ready()
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	<-served
+	if got := strings.Join(order, ","); got != "init,start,ready,stop" {
+		t.Errorf("unexpected hook order %s", got)
+	}
+
+	failing := NewServer(&ServerConfig{}).DisableSignals()
+	failing.OnStart("warmup", func(ConfigContext) error { return errors.New("cache down") })
+	if err := failing.Serve(l); err == nil || !strings.Contains(err.Error(), "cache down") {
+		t.Errorf("failing start hook should abort the start, got %v", err)
+	}
+	select {
+	case <-failing.Ready():
+	default:
+		t.Error("Ready should be closed when the start failed")
+	}
+
+	l, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	failingReady := NewServer(&ServerConfig{}).DisableSignals()
+	failingReady.OnReady("register", func(ConfigContext) error { return errors.New("registry down") })
+	served = make(chan error, 1)
+	go func() { served <- failingReady.Serve(l) }()
+	select {
+	case <-failingReady.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Ready not closed after a failing ready hook")
+	}
+	if err := <-served; err == nil || !strings.Contains(err.Error(), "registry down") || failingReady.isServing() {
+		t.Errorf("failing ready hook should abort the start, got %v", err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Mkdir(filepath.Join(dir, "templates"), 0700)
+	os.Mkdir(filepath.Join(dir, "public"), 0700)
+	write("app.properties", "greeting=hello\nname=world\n")
+	write("templates/page.html", `{{define "page"}}v1{{end}}`)
+	write("public/a.txt", "a")
+	write("config.json", `{
+  "PropertiesConfig": {"PropertiesFiles": [{"Locate": "`+filepath.Join(dir, "app.properties")+`"}]},
+  "Templates": [{"Name": "default", "Dir": "`+filepath.Join(dir, "templates")+`"}]
+}`)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.DisableSignals().SetProperty("cli", "kept")
+	changes := make(chan ConfigChange, 1)
+	s.OnInit("listen", func(c ConfigContext) error {
+		c.AddChangeListener(func(change ConfigChange) { changes <- change })
+		return nil
+	})
+	go s.Serve(l)
+	<-s.Ready()
+	defer s.Stop(context.Background())
+
+	write("app.properties", "greeting=hi\nextra=1\n")
+	write("templates/page.html", `{{define "page"}}v2{{end}}`)
+	write("config.json", `{
+  "PropertiesConfig": {"PropertiesFiles": [{"Locate": "`+filepath.Join(dir, "app.properties")+`"}]},
+  "Templates": [{"Name": "default", "Dir": "`+filepath.Join(dir, "templates")+`"}],
+  "StaticResources": [{"Path": "/public/**", "FileLocate": "`+filepath.Join(dir, "public")+`"}]
+}`)
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	change := <-changes
+	if strings.Join(change.Properties, ",") != "extra,greeting,name" || !change.Templates || !change.StaticResources {
+		t.Errorf("unexpected change %+v", change)
+	}
+	if s.GetProperties("greeting") != "hi" || s.context.ContainsProperty("name") || s.GetProperties("cli") != "kept" {
+		t.Error("properties not swapped")
+	}
+	var page strings.Builder
+	if err := s.context.ExecuteTemplate(&page, "page", nil); err != nil || page.String() != "v2" {
+		t.Errorf("templates not swapped: %q %v", page.String(), err)
+	}
+	resp, err := http.Get("http://" + l.Addr().String() + "/public/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("added static resource not served: %d", resp.StatusCode)
+	}
+
+	write("config.json", `{"Port": "nope"}`)
+	if err := s.Reload(); err == nil || s.GetProperties("greeting") != "hi" {
+		t.Errorf("invalid config should be rejected and the old values kept, got %v", err)
+	}
+}
+
+func TestReloadKeepsAddedEntries(t *testing.T) {
+	configLock.Lock()
+	previous := DefaultSever
+	configLock.Unlock()
+	defer func() {
+		configLock.Lock()
+		DefaultSever = previous
+		configLock.Unlock()
+	}()
+	defer wlog.SetDebug(true)
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	os.Mkdir(filepath.Join(dir, "templates"), 0700)
+	if err := ioutil.WriteFile(filepath.Join(dir, "templates", "page.html"), []byte(`{{define "p"}}added{{end}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	setups := map[string]func() *Server{
+		"server methods": func() *Server {
+			s, err := New(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s.AddTemplate("code", filepath.Join(dir, "templates")).AddStaticSource("/files/**", dir)
+		},
+		"package functions": func() *Server {
+			SetConfigPath(configPath)
+			AddTemplate("code", filepath.Join(dir, "templates"))
+			return AddStaticSource("/files/**", dir)
+		},
+	}
+	for name, setup := range setups {
+		if err := ioutil.WriteFile(configPath, []byte(`{"LogLevel": "debug"}`), 0600); err != nil {
+			t.Fatal(err)
+		}
+		s := setup().DisableSignals()
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go s.Serve(l)
+		<-s.Ready()
+
+		if err := ioutil.WriteFile(configPath, []byte(`{"LogLevel": "error"}`), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Reload(); err != nil {
+			t.Fatal(err)
+		}
+		var page strings.Builder
+		if err := s.context.ExecuteTemplate(&page, "p", nil); err != nil || page.String() != "added" {
+			t.Errorf("%s: template added in code lost by the reload: %q %v", name, page.String(), err)
+		}
+		resp, err := http.Get("http://" + l.Addr().String() + "/files/a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: static resource added in code lost by the reload: %d", name, resp.StatusCode)
+		}
+		s.Stop(context.Background())
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "db")
+	if err := ioutil.WriteFile(secretFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SECRET_TEST_TOKEN", "from-env")
+	var logged strings.Builder
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	s := NewServer(&ServerConfig{PropertiesConfig: PropertiesConfig{Properties: map[string]string{
+		"db.password":   "secret:file:" + secretFile,
+		"api.token":     "secret:env:SECRET_TEST_TOKEN",
+		"mail.secret":   "secret:vault:mail",
+		"mail.url":      "http://mail",
+		"report.file":   "file:report.csv",
+		"smtp.password": "plain-text",
+	}}}).DisableSignals()
+	s.AddSecretProvider("vault", SecretProviderFunc(func(name string) (string, error) { return "from-vault-" + name, nil }))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+	<-s.Ready()
+	for key, expected := range map[string]string{"db.password": "from-file", "api.token": "from-env", "mail.secret": "from-vault-mail",
+		"mail.url": "http://mail", "report.file": "file:report.csv"} {
+		if value := s.GetProperties(key); value != expected {
+			t.Errorf("%s: expected %q, got %q", key, expected, value)
+		}
+	}
+	//the server logs from its own goroutines until it is stopped
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"from-file", "from-env", "from-vault", "plain-text"} {
+		if strings.Contains(logged.String(), secret) {
+			t.Errorf("secret %q logged", secret)
+		}
+	}
+
+	failing := NewServer(&ServerConfig{Databases: []Database{{Name: "RW", DriverName: "mysql", Password: "secret:env:SECRET_TEST_UNSET"}}}).DisableSignals()
+	if err := failing.Serve(l); err == nil || !strings.Contains(err.Error(), "SECRET_TEST_UNSET is not set") {
+		t.Errorf("unresolvable secret should abort the start, got %v", err)
+	}
+	bare := NewServer(&ServerConfig{Databases: []Database{{Name: "RW", DriverName: "mysql", Password: "env:SECRET_TEST_UNSET"}}}).DisableSignals()
+	if err := bare.Serve(l); err == nil || !strings.Contains(err.Error(), "SECRET_TEST_UNSET is not set") {
+		t.Errorf("database password env: reference should be resolved without secret:, got %v", err)
+	}
+	for value, expected := range map[string]string{"env:SECRET_TEST_TOKEN": "from-env", "file:" + secretFile: "from-file",
+		"secret:env:SECRET_TEST_TOKEN": "from-env", "vault:db": "vault:db", "plain": "plain"} {
+		if resolved, err := s.secrets.resolveCredential(value); err != nil || resolved != expected {
+			t.Errorf("credential %s: expected %q, got %q %v", value, expected, resolved, err)
+		}
+	}
+	unknown := NewServer(&ServerConfig{PropertiesConfig: PropertiesConfig{Properties: map[string]string{"key": "secret:kms:key"}}}).DisableSignals()
+	if err := unknown.Serve(l); err == nil || !strings.Contains(err.Error(), "no provider for kms") {
+		t.Errorf("secret of an unknown scheme should abort the start, got %v", err)
+	}
+}
+
+func TestRunMain(t *testing.T) {
+	configLock.Lock()
+	previous := DefaultSever
+	configLock.Unlock()
+	defer func() {
+		configLock.Lock()
+		DefaultSever = previous
+		configLock.Unlock()
+	}()
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(configPath, []byte(`{"Port": "8080", "Health": {"Enable": true}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	run := func(setup func(*Server), args ...string) (int, string, string) {
+		var stdout, stderr strings.Builder
+		code := runMain(args, setup, &stdout, &stderr)
+		return code, stdout.String(), stderr.String()
+	}
+
+	var port, greeting string
+	code, out, _ := run(func(s *Server) {
+		port, greeting = s.config.Port, s.GetProperties("greeting")
+	}, "-config", configPath, "-port", "9090", "-set", "greeting=hello=world", "-print-routes")
+	if code != 0 || port != "9090" || greeting != "hello=world" {
+		t.Errorf("flags not applied: %d %q %q", code, port, greeting)
+	}
+	if code, out, _ = run(func(s *Server) {
+		s.AddHandler("POST", "/users", func() {})
+	}, "-config", configPath, "-print-routes"); code != 0 || !strings.Contains(out, "POST  /users") || !strings.Contains(out, "GET   /healthz") {
+		t.Errorf("routes not printed: %d\n%s", code, out)
+	}
+
+	if code, out, _ = run(nil, "-config", configPath, "-check-config"); code != 0 || out != configPath+": ok\n" {
+		t.Errorf("valid config rejected: %d %q", code, out)
+	}
+	if code, _, errOut := run(nil, "-config", configPath, "-port", "nope", "-check-config"); code != 1 || !strings.Contains(errOut, "Port") {
+		t.Errorf("invalid port accepted: %d %q", code, errOut)
+	}
+	if code, _, _ := run(nil, "-config", filepath.Join(dir, "missing.json"), "-check-config"); code != 1 {
+		t.Errorf("missing config accepted: %d", code)
+	}
+	templates := filepath.Join(dir, "templates")
+	if err := os.Mkdir(templates, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(templates, "page.html"), []byte(`{{define "page"}}{{end`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, errOut := run(func(s *Server) { s.AddTemplate("default", templates) }, "-config", configPath, "-check-config"); code != 1 || !strings.Contains(errOut, "page.html") {
+		t.Errorf("broken template accepted: %d %q", code, errOut)
+	}
+	secretPath := filepath.Join(dir, "secret.json")
+	if err := ioutil.WriteFile(secretPath, []byte(`{"Databases": [{"Name": "RW", "DriverName": "mysql", "Password": "secret:vault:db"}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, errOut := run(nil, "-config", secretPath, "-check-config"); code != 1 || !strings.Contains(errOut, "no provider for vault") {
+		t.Errorf("unresolvable secret accepted: %d %q", code, errOut)
+	}
+	vault := func(s *Server) {
+		s.AddSecretProvider("vault", SecretProviderFunc(func(name string) (string, error) { return "pass", nil }))
+	}
+	if code, out, _ := run(vault, "-config", secretPath, "-check-config"); code != 0 || out != secretPath+": ok\n" {
+		t.Errorf("secret of a provider added by setup rejected: %d %q", code, out)
+	}
+	if code, _, _ := run(nil, "-set", "novalue"); code != 2 {
+		t.Errorf("bad flag accepted: %d", code)
+	}
+}
+
+//init the handler of s without binding a port , requests are served with s.handler.ServeHTTP
+func initTestHandler(t *testing.T, s *Server) {
+	t.Helper()
+	if err := s.handler.init(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStartRetry(t *testing.T) {
+	dir := t.TempDir()
+	page := filepath.Join(dir, "page.html")
+	if err := ioutil.WriteFile(page, []byte(`{{define "page"}}{{end`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(&ServerConfig{Templates: []Template{{Name: "default", Dir: dir}}}).DisableSignals()
+	s.AddHandler("GET", "/", func() []byte { return []byte("ok") })
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := s.Serve(l); err == nil {
+		t.Fatal("broken template should fail the start")
+	}
+	if err := ioutil.WriteFile(page, []byte(`{{define "page"}}{{end}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+	<-s.Ready()
+	defer s.Stop(context.Background())
+	resp, err := http.Get("http://" + l.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the retried start to serve, got %d", resp.StatusCode)
+	}
+}
+
+func TestNewServerValidates(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stderr)
+
+	s := NewServer(&ServerConfig{Port: "nope", Databases: []Database{{Name: "RW"}}}).DisableSignals()
+	if logged := out.String(); !strings.Contains(logged, "Port") || !strings.Contains(logged, "DriverName") {
+		t.Errorf("config problems not logged by NewServer: %q", logged)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := s.Serve(l); err == nil || !strings.Contains(err.Error(), "Port") {
+		t.Errorf("invalid config should fail the start, got %v", err)
+	}
+	out.Reset()
+	NewServer(&ServerConfig{Port: "8080"})
+	if strings.Contains(out.String(), "invalid config") {
+		t.Errorf("valid config reported: %q", out.String())
+	}
+}
+
+func TestStartRetryAfterBindFailure(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(&ServerConfig{Listeners: []Listener{
+		{Name: "web", Address: "127.0.0.1:0"},
+		{Name: "admin", Address: busy.Addr().String()},
+	}}).DisableSignals()
+	if err := s.Start(context.Background()); err == nil {
+		t.Fatal("busy address should fail the start")
+	}
+	busy.Close()
+	started := make(chan error, 1)
+	go func() { started <- s.Start(context.Background()) }()
+	//Ready still returns the channel closed by the failed start until the retry begins
+	for deadline := time.Now().Add(5 * time.Second); !s.isServing(); time.Sleep(5 * time.Millisecond) {
+		select {
+		case err := <-started:
+			t.Fatalf("retried start failed: %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("retried start not serving")
+		}
+	}
+	defer s.Stop(context.Background())
+	s.serversLock.Lock()
+	servers := len(s.httpServers)
+	s.serversLock.Unlock()
+	if servers != 2 {
+		t.Errorf("expected the servers of the retried start only, got %d", servers)
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stderr)
+	defer wlog.SetDebug(true)
+
+	s := NewServer(&ServerConfig{LogLevel: "error"}).DisableSignals()
+	wlog.Debug("built")
+	if !strings.Contains(out.String(), "built") {
+		t.Error("building a server should not change the process log level")
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+	<-s.Ready()
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	wlog.Debug("started")
+	if strings.Contains(out.String(), "started") {
+		t.Error("starting a server with LogLevel error should hide the debug output")
+	}
+}
@@ -1,14 +1,16 @@
 package wserver
 
 import (
+	"context"
 	"github.com/fitmewell/wserver/bdb"
 	"github.com/fitmewell/wserver/wsession"
 	"io"
 	"sync"
+	"time"
 )
 
 type ServletContext interface {
-	ServerContext
+	ConfigContext
 
 	//Get servlet session
 	GetSession() wsession.Session
@@ -18,6 +20,18 @@ type ServletContext interface {
 
 	//set data store in servlet
 	SetData(key string, value interface{})
+
+	//get the request context , done when the client goes away or the route timeout expires
+	GetRequestContext() context.Context
+
+	//get the client ip , resolved through trusted proxies
+	GetClientIP() string
+
+	//get the scheme the client used , http or https
+	GetScheme() string
+
+	//get the host the client requested
+	GetHost() string
 }
 
 /**
@@ -28,10 +42,15 @@ type DefaultServletContext struct {
 	Session       wsession.Session
 	data          map[string]interface{}
 	lock          sync.RWMutex
+	ctx           context.Context
+	clientIP      string
+	scheme        string
+	host          string
 }
 
+//db returned here stops its statements when the request context is done , if it is a bdb.ContextDB
 func (defaultContext *DefaultServletContext) GetDb() bdb.BufferedDB {
-	return defaultContext.ServerContext.GetDb()
+	return defaultContext.withRequestContext(defaultContext.ServerContext.GetDb())
 }
 
 func (defaultContext *DefaultServletContext) Init() {
@@ -39,7 +58,22 @@ func (defaultContext *DefaultServletContext) Init() {
 }
 
 func (defaultContext *DefaultServletContext) GetSelectDb(dbName string) bdb.BufferedDB {
-	return defaultContext.ServerContext.GetSelectDb(dbName)
+	return defaultContext.withRequestContext(defaultContext.ServerContext.GetSelectDb(dbName))
+}
+
+func (defaultContext *DefaultServletContext) withRequestContext(db bdb.BufferedDB) bdb.BufferedDB {
+	contextDb, ok := db.(bdb.ContextDB)
+	if !ok || defaultContext.ctx == nil {
+		return db
+	}
+	return contextDb.WithContext(defaultContext.ctx)
+}
+
+func (defaultContext *DefaultServletContext) GetRequestContext() context.Context {
+	if defaultContext.ctx == nil {
+		return context.Background()
+	}
+	return defaultContext.ctx
 }
 
 func (defaultContext *DefaultServletContext) GetProperty(key string) string {
@@ -50,7 +84,37 @@ func (defaultContext *DefaultServletContext) ContainsProperty(key string) bool {
 	return defaultContext.ServerContext.ContainsProperty(key)
 }
 
+func (defaultContext *DefaultServletContext) GetInt(key string, def int) int {
+	return configContext(defaultContext.ServerContext).GetInt(key, def)
+}
+
+func (defaultContext *DefaultServletContext) GetBool(key string, def bool) bool {
+	return configContext(defaultContext.ServerContext).GetBool(key, def)
+}
+
+func (defaultContext *DefaultServletContext) GetDuration(key string, def time.Duration) time.Duration {
+	return configContext(defaultContext.ServerContext).GetDuration(key, def)
+}
+
+func (defaultContext *DefaultServletContext) GetStringSlice(key string, def []string) []string {
+	return configContext(defaultContext.ServerContext).GetStringSlice(key, def)
+}
+
+func (defaultContext *DefaultServletContext) BindProperties(prefix string, target interface{}) error {
+	return configContext(defaultContext.ServerContext).BindProperties(prefix, target)
+}
+
+func (defaultContext *DefaultServletContext) GetProfile() string {
+	return configContext(defaultContext.ServerContext).GetProfile()
+}
+
+func (defaultContext *DefaultServletContext) AddChangeListener(listener func(ConfigChange)) {
+	configContext(defaultContext.ServerContext).AddChangeListener(listener)
+}
+
 func (defaultContext *DefaultServletContext) GetData() map[string]interface{} {
+	defaultContext.lock.RLock()
+	defer defaultContext.lock.RUnlock()
 	return defaultContext.data
 }
 
@@ -60,6 +124,28 @@ func (defaultContext *DefaultServletContext) SetData(key string, value interface
 	defaultContext.data[key] = value
 }
 
+//copy with its own data , for a handler which may outlive its request
+func (defaultContext *DefaultServletContext) detach() *DefaultServletContext {
+	defaultContext.lock.RLock()
+	defer defaultContext.lock.RUnlock()
+	data := make(map[string]interface{}, len(defaultContext.data))
+	for key, value := range defaultContext.data {
+		data[key] = value
+	}
+	return &DefaultServletContext{ServerContext: defaultContext.ServerContext, Session: defaultContext.Session, data: data,
+		ctx: defaultContext.ctx, clientIP: defaultContext.clientIP, scheme: defaultContext.scheme, host: defaultContext.host}
+}
+
+//take the data of a detached copy whose handler finished
+func (defaultContext *DefaultServletContext) adopt(detached *DefaultServletContext) {
+	detached.lock.RLock()
+	data := detached.data
+	detached.lock.RUnlock()
+	defaultContext.lock.Lock()
+	defaultContext.data = data
+	defaultContext.lock.Unlock()
+}
+
 func (defaultContext *DefaultServletContext) ExecuteTemplate(wr io.Writer, name string, data interface{}) error {
 	return defaultContext.ServerContext.ExecuteTemplate(wr, name, data)
 }
@@ -67,3 +153,15 @@ func (defaultContext *DefaultServletContext) ExecuteTemplate(wr io.Writer, name
 func (defaultContext *DefaultServletContext) GetSession() wsession.Session {
 	return defaultContext.Session
 }
+
+func (defaultContext *DefaultServletContext) GetClientIP() string {
+	return defaultContext.clientIP
+}
+
+func (defaultContext *DefaultServletContext) GetScheme() string {
+	return defaultContext.scheme
+}
+
+func (defaultContext *DefaultServletContext) GetHost() string {
+	return defaultContext.host
+}
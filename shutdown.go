@@ -0,0 +1,123 @@
+package wserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	. "github.com/fitmewell/wserver/log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultShutdownTimeout = 10 * time.Second
+
+type aftermath struct {
+	name    string
+	timeout time.Duration
+	method  func()
+}
+
+//stop accepting , drain in-flight requests until ctx is done , run aftermaths in order and close db pools ,
+//return the errors of whatever failed or missed its deadline
+func (ws *Server) shutdown(ctx context.Context) error {
+	var errs []error
+	if err := ws.runHooks(phaseStop, true); err != nil {
+		errs = append(errs, err)
+	}
+	aftermathTimeout := parseShutdownTimeout(ws.config.Shutdown.AftermathTimeout)
+	deadline, hasDeadline := ctx.Deadline()
+	if delay := readinessDelay(ws.config.Shutdown.ReadinessDelay, deadline, hasDeadline, time.Now()); delay > 0 {
+		//readiness already fails , give load balancers time to stop routing here
+		Debug("waiting ", delay, " before draining")
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+
+	ws.serversLock.Lock()
+	servers := append([]*http.Server(nil), ws.httpServers...)
+	ws.serversLock.Unlock()
+
+	var wg sync.WaitGroup
+	drainErrs := make(chan error, len(servers))
+	for _, s := range servers {
+		wg.Add(1)
+		go func(s *http.Server) {
+			defer wg.Done()
+			if err := s.Shutdown(ctx); err != nil {
+				s.Close()
+				drainErrs <- fmt.Errorf("drain %s failed: %v", s.Addr, err)
+			}
+		}(s)
+	}
+	wg.Wait()
+	close(drainErrs)
+	for err := range drainErrs {
+		Debug(err)
+		errs = append(errs, err)
+	}
+
+	for _, a := range ws.aftermaths {
+		timeout := a.timeout
+		if timeout <= 0 {
+			timeout = aftermathTimeout
+		}
+		if err := runAftermath(a, timeout); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := closeContext(ws.context); err != nil {
+		Debug("close failed: ", err)
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func runAftermath(a aftermath, timeout time.Duration) error {
+	Debug("[aftermath][" + a.name + "]start")
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("aftermath %s panic: %v", a.name, r)
+			}
+		}()
+		a.method()
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		Debug("[aftermath][" + a.name + "]end")
+		return err
+	case <-time.After(timeout):
+		Debug("[aftermath][" + a.name + "]timeout")
+		return errors.New("aftermath " + a.name + " timeout")
+	}
+}
+
+//the configured readiness delay , capped to keep at least half of the time left until deadline for draining
+func readinessDelay(configured string, deadline time.Time, hasDeadline bool, now time.Time) time.Duration {
+	delay, err := time.ParseDuration(configured)
+	if err != nil || delay <= 0 {
+		return 0
+	}
+	if left := deadline.Sub(now); hasDeadline && delay > left/2 {
+		delay = left / 2
+	}
+	return delay
+}
+
+func parseShutdownTimeout(value string) time.Duration {
+	if value == "" {
+		return defaultShutdownTimeout
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		Debug("invalid shutdown timeout ", value, " using ", defaultShutdownTimeout)
+		return defaultShutdownTimeout
+	}
+	return d
+}
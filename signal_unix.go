@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package wserver
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	//signal toggling maintenance mode
+	maintenanceSignal os.Signal = syscall.SIGUSR1
+	//signal starting a hot restart
+	restartSignal os.Signal = syscall.SIGUSR2
+	//signal reloading properties , templates , static resources and the log level
+	reloadSignal os.Signal = syscall.SIGHUP
+)
@@ -0,0 +1,10 @@
+package wserver
+
+import "os"
+
+//windows has no user signals , use Server.SetMaintenance and Server.Reload instead
+var (
+	maintenanceSignal os.Signal = nil
+	restartSignal     os.Signal = nil
+	reloadSignal      os.Signal = nil
+)
@@ -0,0 +1,55 @@
+package wserver
+
+import (
+	. "github.com/fitmewell/wserver/log"
+	"net/http"
+	"sync"
+)
+
+/**
+  Static resource file servers by configured path , replaced as a whole when the config is reloaded
+*/
+type staticResources struct {
+	lock     sync.RWMutex
+	handlers map[string]http.Handler
+}
+
+//serve resources from now on , return the ones whose path was not served before
+func (s *staticResources) set(resources []StaticResource) []StaticResource {
+	handlers := map[string]http.Handler{}
+	var added []StaticResource
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, resource := range resources {
+		path := trimPathWildcard(resource.Path)
+		DebugF("Severing static files: %s %s", path, resource.FileLocate)
+		handlers[resource.Path] = http.StripPrefix(path, http.FileServer(http.Dir(resource.FileLocate)))
+		if _, ok := s.handlers[resource.Path]; !ok {
+			added = append(added, resource)
+		}
+	}
+	s.handlers = handlers
+	return added
+}
+
+//file server of the configured path , nil once a reload removed it
+func (s *staticResources) get(path string) http.Handler {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.handlers[path]
+}
+
+//route the new static resources to their file servers
+func (h *wHandler) setStaticResources(resources []StaticResource) {
+	for _, resource := range h.static.set(resources) {
+		path := resource.Path
+		h.addHandler("GET", path, func(context ServletContext, resp http.ResponseWriter, req *http.Request) error {
+			t := h.static.get(path)
+			if t == nil {
+				return STATUS_NOT_FOUND
+			}
+			t.ServeHTTP(resp, req)
+			return nil
+		})
+	}
+}
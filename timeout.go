@@ -0,0 +1,198 @@
+package wserver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type routeTimeout struct {
+	path    string
+	timeout time.Duration
+}
+
+//deadlines resolved from Timeout config , the longest matching route wins
+type timeoutTable struct {
+	defaultTimeout time.Duration
+	routes         []routeTimeout
+}
+
+func newTimeoutTable(config Timeout) (*timeoutTable, error) {
+	table := &timeoutTable{}
+	if config.Default != "" {
+		d, err := time.ParseDuration(config.Default)
+		if err != nil {
+			return nil, err
+		}
+		table.defaultTimeout = d
+	}
+	for _, route := range config.Routes {
+		d, err := time.ParseDuration(route.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		table.routes = append(table.routes, routeTimeout{path: trimPathWildcard(route.Path), timeout: d})
+	}
+	return table, nil
+}
+
+func (t *timeoutTable) get(path string) time.Duration {
+	if t == nil {
+		return 0
+	}
+	matched := -1
+	timeout := t.defaultTimeout
+	for _, route := range t.routes {
+		if len(route.path) > matched && pathUnder(path, route.path) {
+			matched = len(route.path)
+			timeout = route.timeout
+		}
+	}
+	return timeout
+}
+
+//path is prefix or lies below it , /api covers /api/users but not /apiv2 , a trailing / is ignored
+func pathUnder(path string, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+//strip the trailing * or ** of a handler path
+func trimPathWildcard(path string) string {
+	if strings.HasSuffix(path, "**") {
+		path = path[0 : len(path)-2]
+	}
+	if strings.HasSuffix(path, "*") {
+		path = path[0 : len(path)-1]
+	}
+	return path
+}
+
+//returned when the deadline expired after the handler flushed or hijacked , there is no way to answer 504
+var errResponseStarted = errors.New("deadline expired after the response started")
+
+//buffer of a handler running under a deadline , written to the response only when the handler finished in time ,
+//Flush and Hijack commit the response for streaming and websocket handlers , they lose the 504 answer
+type timeoutWriter struct {
+	resp      http.ResponseWriter
+	lock      sync.Mutex
+	header    http.Header
+	status    int
+	body      bytes.Buffer
+	timedOut  bool
+	committed bool
+	hijacked  bool
+}
+
+func newTimeoutWriter(resp http.ResponseWriter) *timeoutWriter {
+	return &timeoutWriter{resp: resp, header: resp.Header().Clone()}
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.status != 0 || w.timedOut || w.hijacked {
+		return
+	}
+	w.status = code
+	if w.committed {
+		w.copyHeader()
+		w.resp.WriteHeader(code)
+	}
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if w.hijacked {
+		return 0, http.ErrHijacked
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.committed {
+		return w.resp.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+//send what is buffered and write through from now on
+func (w *timeoutWriter) Flush() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.timedOut || w.hijacked {
+		return
+	}
+	w.commit()
+	http.NewResponseController(w.resp).Flush()
+}
+
+//hand the connection over , the deadline no longer answers
+func (w *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.timedOut {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	conn, rw, err := http.NewResponseController(w.resp).Hijack()
+	if err == nil {
+		w.hijacked = true
+		w.committed = true
+	}
+	return conn, rw, err
+}
+
+//drop what the handler wrote , its later writes fail with http.ErrHandlerTimeout ,
+//return false when the response was already committed
+func (w *timeoutWriter) timeout() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.timedOut = true
+	w.body.Reset()
+	return !w.committed
+}
+
+//send headers , status and body once the handler finished
+func (w *timeoutWriter) finish() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if !w.hijacked {
+		w.commit()
+	}
+}
+
+//call with the lock held
+func (w *timeoutWriter) commit() {
+	if w.committed {
+		return
+	}
+	w.committed = true
+	w.copyHeader()
+	if w.status != 0 {
+		w.resp.WriteHeader(w.status)
+	}
+	w.resp.Write(w.body.Bytes())
+	w.body.Reset()
+}
+
+func (w *timeoutWriter) copyHeader() {
+	header := w.resp.Header()
+	for name := range header {
+		delete(header, name)
+	}
+	for name, values := range w.header {
+		header[name] = values
+	}
+}
@@ -0,0 +1,155 @@
+package wserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeoutTable(t *testing.T) {
+	table, err := newTimeoutTable(Timeout{Default: "30s", Routes: []RouteTimeout{
+		{Path: "/report/**", Timeout: "2m"},
+		{Path: "/report/fast/*", Timeout: "1s"},
+		{Path: "/api", Timeout: "5s"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, expected := range map[string]time.Duration{
+		"/":                30 * time.Second,
+		"/report/a":        2 * time.Minute,
+		"/report/fast/one": time.Second,
+		"/report/fast":     time.Second,
+		"/api":             5 * time.Second,
+		"/api/users":       5 * time.Second,
+		"/apiv2":           30 * time.Second,
+	} {
+		if timeout := table.get(path); timeout != expected {
+			t.Errorf("%s: expected %v, got %v", path, expected, timeout)
+		}
+	}
+	if _, err := newTimeoutTable(Timeout{Default: "soon"}); err == nil {
+		t.Error("invalid duration accepted")
+	}
+}
+
+func TestPathUnder(t *testing.T) {
+	cases := []struct {
+		path   string
+		prefix string
+		under  bool
+	}{
+		{"/", "/", true},
+		{"/any", "", true},
+		{"/api", "/api", true},
+		{"/api/users", "/api", true},
+		{"/api", "/api/", true},
+		{"/api/users", "/api/", true},
+		{"/apiv2", "/api", false},
+		{"/apifoo/x", "/api/", false},
+		{"/ap", "/api", false},
+	}
+	for _, c := range cases {
+		if under := pathUnder(c.path, c.prefix); under != c.under {
+			t.Errorf("pathUnder(%q, %q) = %v", c.path, c.prefix, under)
+		}
+	}
+}
+
+func TestRequestDeadline(t *testing.T) {
+	s := NewServer(&ServerConfig{Timeout: Timeout{Default: "100ms"}})
+	s.AddHandler("GET", "/slow", func(c ServletContext) error {
+		<-c.GetRequestContext().Done()
+		return c.GetRequestContext().Err()
+	})
+	release := make(chan struct{})
+	defer close(release)
+	s.AddHandler("GET", "/ignoring", func() []byte {
+		<-release
+		return []byte("done")
+	})
+	s.AddHandler("GET", "/fast", func(resp http.ResponseWriter) {
+		resp.Header().Set("X-Handler", "fast")
+		resp.WriteHeader(http.StatusCreated)
+		resp.Write([]byte("fast"))
+	})
+	initTestHandler(t, s)
+
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, httptest.NewRequest("GET", "/slow", nil))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected 504 once the deadline expired, got %d", rec.Code)
+	}
+	//a handler ignoring the context is answered for when the deadline expires
+	rec = httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, httptest.NewRequest("GET", "/ignoring", nil))
+	if rec.Code != http.StatusGatewayTimeout || strings.Contains(rec.Body.String(), "done") {
+		t.Errorf("expected 504 for a handler ignoring the deadline, got %d %q", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, httptest.NewRequest("GET", "/fast", nil))
+	if rec.Code != http.StatusCreated || rec.Body.String() != "fast" || rec.Header().Get("X-Handler") != "fast" {
+		t.Errorf("response of a handler within the deadline not written: %d %q %v", rec.Code, rec.Body.String(), rec.Header())
+	}
+	//a cancelled request is not answered , the client is gone
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec = httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, httptest.NewRequest("GET", "/slow", nil).WithContext(ctx))
+	if rec.Body.Len() != 0 || rec.Code == http.StatusServiceUnavailable {
+		t.Errorf("cancelled request answered: %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRequestDeadlineLateHandler(t *testing.T) {
+	s := NewServer(&ServerConfig{Timeout: Timeout{Default: "50ms"}})
+	release, finished, streamed := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	s.AddHandler("GET", "/late", func(c ServletContext) {
+		<-release
+		c.SetData("late", true)
+		c.GetData()["late"] = true
+		close(finished)
+	})
+	s.AddHandler("GET", "/stream", func(c ServletContext, resp http.ResponseWriter) {
+		resp.Write([]byte("first"))
+		resp.(http.Flusher).Flush()
+		<-release
+		if _, err := resp.Write([]byte("dropped")); err != http.ErrHandlerTimeout {
+			t.Errorf("write after the deadline should fail, got %v", err)
+		}
+		close(streamed)
+	})
+	s.AddHandler("GET", "/data", func(c ServletContext) { c.SetData("handler", "set") })
+	var seen []interface{}
+	s.AddAspectHandler(&DefaultAspectHandler{MatchPath: "/", Execute: func(c ServletContext, resp http.ResponseWriter, req *http.Request) bool {
+		seen = append(seen, c.GetData()["handler"])
+		for range c.GetData() {
+		}
+		return true
+	}})
+	initTestHandler(t, s)
+
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, httptest.NewRequest("GET", "/late", nil))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected 504, got %d", rec.Code)
+	}
+	stream := httptest.NewRecorder()
+	s.handler.ServeHTTP(stream, httptest.NewRequest("GET", "/stream", nil))
+	//the late handlers go on with their own data and writer
+	close(release)
+	<-finished
+	<-streamed
+	if stream.Code != http.StatusOK || stream.Body.String() != "first" || !stream.Flushed {
+		t.Errorf("flushed response should be kept and later writes dropped, got %d %q", stream.Code, stream.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, httptest.NewRequest("GET", "/data", nil))
+	if len(seen) != 3 || seen[2] != "set" {
+		t.Errorf("data set by a handler in time should reach the after aspects, got %v", seen)
+	}
+}
@@ -0,0 +1,225 @@
+package wserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	. "github.com/fitmewell/wserver/log"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require":            tls.RequireAnyClientCert,
+	"verify_if_given":    tls.VerifyClientCertIfGiven,
+	"require_and_verify": tls.RequireAndVerifyClientCert,
+}
+
+//build the tls config of a listener serving certFile/keyFile plus SSLConfig.Certificates
+func (ws *Server) newTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	config := ws.config.SSLConfig
+	if config.DevCertificate.Enable && (certFile == "" || !fileExists(certFile) || !fileExists(keyFile)) {
+		var err error
+		if certFile, keyFile, err = ws.devCertificate(); err != nil {
+			return nil, err
+		}
+	}
+	pairs := []Certificate{}
+	if certFile != "" {
+		pairs = append(pairs, Certificate{CertFile: certFile, KeyFile: keyFile})
+	}
+	pairs = append(pairs, config.Certificates...)
+	if len(pairs) == 0 {
+		return nil, errors.New("no certificate configured")
+	}
+	store := &certStore{pairs: pairs}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+	ws.certStores = append(ws.certStores, store)
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: store.getCertificate}
+	if config.MinVersion != "" {
+		version, ok := tlsVersions[config.MinVersion]
+		if !ok {
+			return nil, errors.New("unknown tls version " + config.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+	if len(config.CipherSuites) != 0 {
+		suites := map[string]uint16{}
+		for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+			suites[suite.Name] = suite.ID
+		}
+		for _, name := range config.CipherSuites {
+			id, ok := suites[name]
+			if !ok {
+				return nil, errors.New("unknown cipher suite " + name)
+			}
+			tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+		}
+	}
+	if config.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificate found in " + config.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if config.ClientAuth != "" {
+		auth, ok := clientAuthTypes[config.ClientAuth]
+		if !ok {
+			return nil, errors.New("unknown client auth " + config.ClientAuth)
+		}
+		tlsConfig.ClientAuth = auth
+	}
+	return tlsConfig, nil
+}
+
+//reload changed certificate files every SSLConfig.ReloadInterval until the server stops
+func (ws *Server) watchCertificates() error {
+	if ws.config.SSLConfig.ReloadInterval == "" || len(ws.certStores) == 0 {
+		return nil
+	}
+	interval, err := time.ParseDuration(ws.config.SSLConfig.ReloadInterval)
+	if err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				for _, store := range ws.certStores {
+					if err := store.reloadChanged(); err != nil {
+						Debug("certificate reload failed: ", err)
+					}
+				}
+			case <-ws.stopped:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+/**
+  Certificates of a tls listener , picked by SNI and reloaded when their files change
+*/
+type certStore struct {
+	lock     sync.RWMutex
+	pairs    []Certificate
+	certs    []*tls.Certificate
+	modTimes []time.Time
+}
+
+func (s *certStore) load() error {
+	certs := make([]*tls.Certificate, 0, len(s.pairs))
+	modTimes := make([]time.Time, 0, len(s.pairs))
+	for _, pair := range s.pairs {
+		cert, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+		if err != nil {
+			return err
+		}
+		certs = append(certs, &cert)
+		modTimes = append(modTimes, pairModTime(pair))
+	}
+	s.lock.Lock()
+	s.certs = certs
+	s.modTimes = modTimes
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *certStore) reloadChanged() error {
+	s.lock.RLock()
+	changed := false
+	for i, pair := range s.pairs {
+		if !pairModTime(pair).Equal(s.modTimes[i]) {
+			changed = true
+		}
+	}
+	s.lock.RUnlock()
+	if !changed {
+		return nil
+	}
+	Debug("reloading certificates")
+	return s.load()
+}
+
+func (s *certStore) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for _, cert := range s.certs {
+		if hello.SupportsCertificate(cert) == nil {
+			return cert, nil
+		}
+	}
+	return s.certs[0], nil
+}
+
+func pairModTime(pair Certificate) time.Time {
+	var latest time.Time
+	for _, file := range []string{pair.CertFile, pair.KeyFile} {
+		if stat, err := os.Stat(file); err == nil && stat.ModTime().After(latest) {
+			latest = stat.ModTime()
+		}
+	}
+	return latest
+}
+
+//redirect plain http to https as configured in SSLConfig.Redirect
+func (ws *Server) redirectHandler() http.Handler {
+	redirect := ws.config.SSLConfig.Redirect
+	port := redirect.Port
+	if port == "" {
+		port = ws.config.SSLConfig.SSLPort
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//already https at a trusted proxy , redirecting would loop
+		if ws.handler.proxies.scheme(r) == "https" {
+			ws.handler.ServeHTTP(w, r)
+			return
+		}
+		host := stripPort(ws.handler.proxies.host(r))
+		if port == "" || port == "443" {
+			if strings.Contains(host, ":") {
+				host = "[" + host + "]"
+			}
+		} else {
+			host = net.JoinHostPort(host, port)
+		}
+		code := http.StatusMovedPermanently
+		if redirect.Temporary {
+			code = http.StatusFound
+		}
+		//keep the method and body of non GET requests
+		if r.Method != "GET" && r.Method != "HEAD" {
+			code = http.StatusPermanentRedirect
+			if redirect.Temporary {
+				code = http.StatusTemporaryRedirect
+			}
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+	})
+}
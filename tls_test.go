@@ -0,0 +1,135 @@
+package wserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//self signed certificate for host written to dir
+func writeTestCertificate(t *testing.T, dir string, host string) (certFile string, keyFile string) {
+	t.Helper()
+	certFile, keyFile = filepath.Join(dir, host+".crt"), filepath.Join(dir, host+".key")
+	template := &x509.Certificate{Subject: pkix.Name{CommonName: host}, DNSNames: []string{host},
+		KeyUsage: x509.KeyUsageDigitalSignature, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}
+	if _, _, err := createCertificate(template, time.Hour, nil, nil, certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestRedirectHandler(t *testing.T) {
+	cases := []struct {
+		redirect Redirect
+		method   string
+		code     int
+		location string
+	}{
+		{Redirect{}, "GET", http.StatusMovedPermanently, "https://example.com:8443/a?b=c"},
+		{Redirect{}, "POST", http.StatusPermanentRedirect, "https://example.com:8443/a?b=c"},
+		{Redirect{Temporary: true}, "GET", http.StatusFound, "https://example.com:8443/a?b=c"},
+		{Redirect{Temporary: true}, "PUT", http.StatusTemporaryRedirect, "https://example.com:8443/a?b=c"},
+		{Redirect{Port: "443"}, "GET", http.StatusMovedPermanently, "https://example.com/a?b=c"},
+	}
+	for _, c := range cases {
+		s := NewServer(&ServerConfig{UseSSL: true, SSLConfig: SSLConfig{SSLPort: "8443", Redirect: c.redirect}})
+		initTestHandler(t, s)
+		rec := httptest.NewRecorder()
+		s.redirectHandler().ServeHTTP(rec, httptest.NewRequest(c.method, "http://example.com:8080/a?b=c", nil))
+		if rec.Code != c.code || rec.Header().Get("Location") != c.location {
+			t.Errorf("%+v %s: expected %d %s, got %d %s", c.redirect, c.method, c.code, c.location, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	aCert, aKey := writeTestCertificate(t, dir, "a.test")
+	bCert, bKey := writeTestCertificate(t, dir, "b.test")
+	s := NewServer(&ServerConfig{SSLConfig: SSLConfig{MinVersion: "1.3", Certificates: []Certificate{{CertFile: bCert, KeyFile: bKey}}}})
+	config, err := s.newTLSConfig(aCert, aKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	served := func(serverName string, maxVersion uint16) (string, error) {
+		conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{ServerName: serverName, InsecureSkipVerify: true, MaxVersion: maxVersion})
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+	}
+	for serverName, expected := range map[string]string{"a.test": "a.test", "b.test": "b.test", "other.test": "a.test"} {
+		if name, err := served(serverName, 0); err != nil || name != expected {
+			t.Errorf("SNI %s: expected %s, got %s %v", serverName, expected, name, err)
+		}
+	}
+	if _, err := served("a.test", tls.VersionTLS12); err == nil {
+		t.Error("tls 1.2 should be refused with MinVersion 1.3")
+	}
+
+	for _, ssl := range []SSLConfig{{MinVersion: "2.0"}, {CipherSuites: []string{"TLS_NOPE"}}, {ClientAuth: "maybe"}, {ClientCAFile: aKey}} {
+		s := NewServer(&ServerConfig{SSLConfig: ssl})
+		if _, err := s.newTLSConfig(aCert, aKey); err == nil {
+			t.Errorf("%+v should be rejected", ssl)
+		}
+	}
+	s = NewServer(&ServerConfig{SSLConfig: SSLConfig{ClientCAFile: aCert}})
+	if config, err := s.newTLSConfig(aCert, aKey); err != nil || config.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("ClientCAFile should require verified client certificates, got %v", err)
+	}
+}
+
+func TestHSTSOnlyOverTLS(t *testing.T) {
+	s := NewServer(&ServerConfig{TrustedProxies: []string{"10.0.0.0/8"},
+		SecurityHeaders: SecurityHeaders{Enable: true, HSTSIncludeSubDomains: true}})
+	s.AddHandler("GET", "/", func() []byte { return []byte("ok") })
+	initTestHandler(t, s)
+	cases := []struct {
+		name   string
+		remote string
+		tls    bool
+		proto  string
+		hsts   string
+	}{
+		{"plain http", "198.51.100.1:4000", false, "", ""},
+		{"direct tls", "198.51.100.1:4000", true, "", "max-age=31536000; includeSubDomains"},
+		{"trusted tls terminating proxy", "10.0.0.2:4000", false, "https", "max-age=31536000; includeSubDomains"},
+		{"spoofed proto", "198.51.100.1:4000", false, "https", ""},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = c.remote
+		if c.tls {
+			req.TLS = &tls.ConnectionState{}
+		}
+		if c.proto != "" {
+			req.Header.Set("X-Forwarded-Proto", c.proto)
+		}
+		rec := httptest.NewRecorder()
+		s.handler.ServeHTTP(rec, req)
+		if hsts := rec.Header().Get("Strict-Transport-Security"); hsts != c.hsts {
+			t.Errorf("%s: expected HSTS %q, got %q", c.name, c.hsts, hsts)
+		}
+	}
+}
@@ -1,10 +1,10 @@
 package wserver
 
 import (
-	"errors"
+	"context"
 	"github.com/fitmewell/wserver/bdb"
-	"github.com/fitmewell/wserver/wsession"
 	"sync"
+	"time"
 )
 
 //Default sever context defined for simple running , use customer Server if you want a custom config
@@ -19,6 +19,7 @@ func SetConfigPath(filePath string) {
 		panic(err)
 	}
 	SetConfig(config)
+	DefaultSever.configPath = filePath
 }
 
 //set config for default server context
@@ -26,14 +27,7 @@ func SetConfig(config *ServerConfig) {
 	configLock.Lock()
 	defer configLock.Unlock()
 
-	DefaultSever = &Server{
-		config:         config,
-		sessionManager: wsession.NewDefaultSessionManager(config.Session.CookieName),
-		aftermaths:     map[string]func(){},
-	}
-
-	DefaultSever.handler = newDefaultHandler(DefaultSever)
-	DefaultSever.context = NewContextFrom(DefaultSever.config)
+	DefaultSever = NewServer(config)
 }
 
 //set port for default server context
@@ -54,14 +48,22 @@ func AddHandler(method string, path string, e interface{}) *Server {
 
 //add static source path handler to default server
 func AddStaticSource(path, fileLocate string) *Server {
-	DefaultSever.config.StaticResources = append(DefaultSever.config.StaticResources, StaticResource{Path: path, FileLocate: fileLocate})
-	return DefaultSever
+	return DefaultSever.AddStaticSource(path, fileLocate)
 }
 
 //add template path to default server
 func AddTemplate(name, dir string) *Server {
-	DefaultSever.config.Templates = append(DefaultSever.config.Templates, Template{Name: name, Dir: dir})
-	return DefaultSever
+	return DefaultSever.AddTemplate(name, dir)
+}
+
+//add request deadline for path to default server
+func AddTimeout(path string, timeout time.Duration) *Server {
+	return DefaultSever.AddTimeout(path, timeout)
+}
+
+//add secret provider for values "secret:<scheme>:<name>" to default server
+func AddSecretProvider(scheme string, provider SecretProvider) *Server {
+	return DefaultSever.AddSecretProvider(scheme, provider)
 }
 
 //add aspect handler to default server
@@ -70,13 +72,30 @@ func AddAspectHandler(handler AspectHandler) *Server {
 	return DefaultSever
 }
 
-//add handler before server close ,you have 10 second before server close to finish your work to default server
+//add handler run on default server close , after in-flight requests are drained ,
+//each one has Shutdown.AftermathTimeout (10 seconds by default) to finish its work
 func AddAftermath(name string, method func()) error {
-	if _, ok := DefaultSever.aftermaths[name]; ok {
-		return errors.New("duplicate aftermatch found")
-	}
-	DefaultSever.aftermaths[name] = method
-	return nil
+	return DefaultSever.AddAftermath(name, method)
+}
+
+//run hook on default server once its context is initialised
+func OnInit(name string, method func(ConfigContext) error) *Server {
+	return DefaultSever.OnInit(name, method)
+}
+
+//run hook on default server before its ports are bound
+func OnStart(name string, method func(ConfigContext) error) *Server {
+	return DefaultSever.OnStart(name, method)
+}
+
+//run hook on default server once it is serving
+func OnReady(name string, method func(ConfigContext) error) *Server {
+	return DefaultSever.OnReady(name, method)
+}
+
+//run hook on default server when its shutdown begins
+func OnStop(name string, method func(ConfigContext) error) *Server {
+	return DefaultSever.OnStop(name, method)
 }
 
 //get default server's context properties
@@ -94,7 +113,12 @@ func GetSelectDb(name string) bdb.BufferedDB {
 	return DefaultSever.context.GetSelectDb(name)
 }
 
-//start default server
-func Start() {
-	DefaultSever.Start()
+//start default server , block until it stops
+func Start() error {
+	return DefaultSever.Start(context.Background())
+}
+
+//stop default server
+func Stop(ctx context.Context) error {
+	return DefaultSever.Stop(ctx)
 }
@@ -1,6 +1,7 @@
 package wsession
 
 import (
+	"sync"
 	"time"
 )
 
@@ -17,7 +18,9 @@ type Session interface {
 }
 
 type defaultSession struct {
-	name       string
+	name string
+	//requests of one session may run in parallel
+	lock       sync.RWMutex
 	properties map[string]interface{}
 	createTime time.Time
 	expireTime time.Time
@@ -28,27 +31,41 @@ func (ds *defaultSession) Name() string {
 }
 
 func (ds *defaultSession) Get(key string) interface{} {
+	ds.lock.RLock()
+	defer ds.lock.RUnlock()
 	return ds.properties[key]
 }
 func (ds *defaultSession) Set(key string, value interface{}) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
 	ds.properties[key] = value
 }
 
 func (ds *defaultSession) SetCreateTime(t time.Time) error {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
 	ds.createTime = t
 	return nil
 }
 func (ds *defaultSession) SetExpireTime(t time.Time) error {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
 	ds.expireTime = t
 	return nil
 }
 func (ds *defaultSession) Del(key string) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
 	delete(ds.properties, key)
 }
 func (ds *defaultSession) GetCreateTime() time.Time {
+	ds.lock.RLock()
+	defer ds.lock.RUnlock()
 	return ds.createTime
 }
 func (ds *defaultSession) GetExpireTime() time.Time {
+	ds.lock.RLock()
+	defer ds.lock.RUnlock()
 	return ds.expireTime
 }
 func (ds *defaultSession) IsExpire() bool {
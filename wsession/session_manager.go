@@ -3,6 +3,7 @@ package wsession
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"io"
 	"net/http"
 	"sync"
@@ -27,23 +28,42 @@ type defaultSessionManager struct {
 }
 
 func (ds *defaultSessionManager) NewSession() Session {
-	tmpSession := &defaultSession{name: ds.NewId(), properties: map[string]interface{}{}, createTime: time.Now(), expireTime: time.Now().Add(ds.lifeTime)}
-	ds.sessionMap[tmpSession.Name()] = tmpSession
-	return tmpSession
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	return ds.newSession()
 }
 func (ds *defaultSessionManager) DeleteSession(key string) error {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
 	delete(ds.sessionMap, key)
 	return nil
 }
 func (ds *defaultSessionManager) GetSession(key string) Session {
-	return ds.sessionMap[key]
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	return ds.getSession(key)
+}
+
+//the map is shared by the request goroutines and Scan , the unexported methods expect the lock held
+func (ds *defaultSessionManager) newSession() Session {
+	tmpSession := &defaultSession{name: ds.NewId(), properties: map[string]interface{}{}, createTime: time.Now(), expireTime: time.Now().Add(ds.lifeTime)}
+	ds.sessionMap[tmpSession.Name()] = tmpSession
+	return tmpSession
+}
+func (ds *defaultSessionManager) getSession(key string) Session {
+	if session, ok := ds.sessionMap[key]; ok {
+		return session
+	}
+	return nil
 }
 func (ds *defaultSessionManager) Scan() {
+	ds.lock.Lock()
 	for key, value := range ds.sessionMap {
 		if value.IsExpire() {
-			ds.DeleteSession(key)
+			delete(ds.sessionMap, key)
 		}
 	}
+	ds.lock.Unlock()
 	time.AfterFunc(ds.scanTime, ds.Scan)
 }
 func (ds *defaultSessionManager) NewId() string {
@@ -58,10 +78,10 @@ func (ds *defaultSessionManager) Sync(resp http.ResponseWriter, req *http.Reques
 	defer ds.lock.Unlock()
 	ck, _ := req.Cookie(ds.cookieName)
 	var tmpSession Session
-	if ck == nil || ds.GetSession(ck.Value) == nil || ds.GetSession(ck.Value).IsExpire() {
-		tmpSession = ds.NewSession()
+	if ck == nil || ds.getSession(ck.Value) == nil || ds.getSession(ck.Value).IsExpire() {
+		tmpSession = ds.newSession()
 	} else {
-		tmpSession = ds.GetSession(ck.Value)
+		tmpSession = ds.getSession(ck.Value)
 		tmpSession.SetExpireTime(time.Now().Add(ds.lifeTime))
 	}
 	cookie := &http.Cookie{Name: ds.cookieName, Value: tmpSession.Name(), Path: "/", Expires: tmpSession.GetExpireTime()}
@@ -69,6 +89,28 @@ func (ds *defaultSessionManager) Sync(resp http.ResponseWriter, req *http.Reques
 	return tmpSession
 }
 
+//store a probe session , read it back and delete it , the id generation is checked on the way
+func (ds *defaultSessionManager) Ping() error {
+	id := ds.NewId()
+	if id == "" {
+		return errors.New("session id generation failed")
+	}
+	now := time.Now()
+	probe := &defaultSession{name: id, properties: map[string]interface{}{}, createTime: now, expireTime: now}
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	ds.sessionMap[id] = probe
+	stored := ds.getSession(id)
+	delete(ds.sessionMap, id)
+	if stored != probe {
+		return errors.New("session store round trip failed")
+	}
+	if ds.getSession(id) != nil {
+		return errors.New("probe session not deleted")
+	}
+	return nil
+}
+
 func NewDefaultSessionManager(name string) SessionManager {
 	if name == "" {
 		name = "wServerSession"